@@ -2,21 +2,113 @@ package cmd
 
 import (
 	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/c-14/gtenlog/storage"
 )
 
+func parseSCxTypes(types string) ([]string, error) {
+	var scxTypes []string
+	for _, scx := range strings.Split(types, ",") {
+		scx = strings.TrimSpace(scx)
+		switch scx {
+		case "sca", "scb", "scc", "scd", "sce":
+			scxTypes = append(scxTypes, scx)
+		default:
+			return nil, usageErrorf("Unknown log type %q, expecting sca, scb, scc, scd or sce", scx)
+		}
+	}
+	return scxTypes, nil
+}
+
+func checkAggregations(archive storage.LogArchive) error {
+	records, err := archive.ReadAggregationRecords()
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0, len(records))
+	for file := range records {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	failed := 0
+	for _, file := range files {
+		if err = archive.CheckAggregation(records[file]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return DataError{fmt.Errorf("%d of %d aggregated logs failed verification", failed, len(files))}
+	}
+	return nil
+}
+
 func Aggregate(args []string) error {
-	if len(args) != 1 {
-		return errors.New("usage: grue aggregate <log_root>")
+	if len(args) < 1 {
+		return UsageError{errors.New("usage: grue aggregate <log_root> [-t <types>] [-c <date>|-age <days>] [-attic] [-dry-run] [-check]")}
 	}
 	var path string = args[0]
+	var types, cutoffDate string
+	var age int
+	var attic, dryRun, check bool
+
+	var aggregateFlags = flag.NewFlagSet("aggregate", flag.ExitOnError)
+	aggregateFlags.StringVar(&types, "t", "scb,scc,scd,sce", "Comma separated log types to aggregate")
+	aggregateFlags.StringVar(&cutoffDate, "c", "", "Only aggregate hourly logs from before this date")
+	aggregateFlags.IntVar(&age, "age", 8, "Only aggregate hourly logs at least this many days old")
+	aggregateFlags.BoolVar(&attic, "attic", false, "Move aggregated hourly logs to <log_root>/attic instead of deleting them")
+	aggregateFlags.BoolVar(&dryRun, "dry-run", false, "Print the planned merges and deletions without changing anything")
+	aggregateFlags.BoolVar(&check, "check", false, "Verify earlier aggregated logs against aggregations.index instead of aggregating")
+	err := aggregateFlags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	archive := storage.LogArchive{PathRoot: path}
+	if check {
+		return checkAggregations(archive)
+	}
+
+	scxTypes, err := parseSCxTypes(types)
+	if err != nil {
+		return err
+	}
 
 	japan, _ := time.LoadLocation("Japan")
 	now := time.Now().In(japan)
 	now = time.Date(now.Year(), now.Month(), now.Day(), 00, 00, 00, 00, japan)
+	cutoff := now.AddDate(0, 0, -age)
+	if cutoffDate != "" {
+		ageSet := false
+		aggregateFlags.Visit(func(f *flag.Flag) {
+			ageSet = ageSet || f.Name == "age"
+		})
+		if ageSet {
+			return usageErrorf("-c and -age can not be used together")
+		}
+		cutoff, err = time.ParseInLocation("2006-01-02", cutoffDate, japan)
+		if err != nil {
+			return usageErrorf("Failed to parse cutoff date: %s", err)
+		}
+	}
 
-	archive := storage.LogArchive{PathRoot: path}
-	return archive.AggregateLogs(japan, now.AddDate(0, 0, -8))
+	if !dryRun {
+		if err := archive.RemoveTempFiles(); err != nil {
+			return err
+		}
+	}
+	return archive.AggregateLogs(japan, storage.AggregateOptions{
+		Types:  scxTypes,
+		Cutoff: cutoff,
+		Attic:  attic,
+		DryRun: dryRun,
+		Plan:   os.Stdout,
+	})
 }
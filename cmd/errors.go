@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// UsageError is returned when a command is called with missing or invalid
+// arguments, such as an unknown mode, a malformed date or a bad filter.
+type UsageError struct {
+	Err error
+}
+
+func (e UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e UsageError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError is returned when the endpoint configuration or the
+// directories given for it can't be used.
+type ConfigError struct {
+	Err error
+}
+
+func (e ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// DataError is returned when an input file, such as a user mapping or a list
+// of log IDs, was read but doesn't contain what we expect.
+type DataError struct {
+	Err error
+}
+
+func (e DataError) Error() string {
+	return e.Err.Error()
+}
+
+func (e DataError) Unwrap() error {
+	return e.Err
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return UsageError{fmt.Errorf(format, a...)}
+}
+
+func configErrorf(format string, a ...interface{}) error {
+	return ConfigError{fmt.Errorf(format, a...)}
+}
+
+// dataErrorf wraps the error as a DataError unless reading the input failed,
+// which is left for the caller to report as an I/O error.
+func dataErrorf(format string, a ...interface{}) error {
+	err := fmt.Errorf(format, a...)
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+	return DataError{err}
+}
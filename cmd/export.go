@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/c-14/gtenlog/mjlog"
+	"github.com/c-14/gtenlog/storage"
+	"github.com/c-14/gtenlog/tenhou"
+)
+
+var exportUsage error = UsageError{errors.New("usage: gtenlog export [-f <format>] [-l <logRoot>] <logID|path>")}
+
+func openGameLog(logRoot string, log string) (*os.File, string, error) {
+	if info, err := os.Stat(log); err == nil && info.Mode().IsRegular() {
+		file, err := os.Open(log)
+		return file, strings.TrimSuffix(filepath.Base(log), ".xml"), err
+	}
+
+	if logID, err := tenhou.CanonicalLogID(log); err == nil {
+		log = logID
+	}
+
+	archive := storage.LogArchive{PathRoot: logRoot}
+	info, err := archive.FindUserLog(log)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := archive.OpenUserLog(info)
+	return file, info.LogID, err
+}
+
+func Export(args []string) error {
+	var oFormat string
+	var logRoot string
+
+	var exportFlags = flag.NewFlagSet("export", flag.ExitOnError)
+	exportFlags.StringVar(&oFormat, "f", "tenhou6", "Format to export the game log to [tenhou6/mjai]")
+	exportFlags.StringVar(&logRoot, "l", ".", "Log root to look up log IDs in")
+	err := exportFlags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if exportFlags.NArg() != 1 {
+		return exportUsage
+	}
+
+	file, logID, err := openGameLog(logRoot, exportFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch {
+	case oFormat == "tenhou6":
+		game, err := mjlog.ConvertTenhou6(file)
+		if err != nil {
+			return DataError{fmt.Errorf("Failed to convert %s: %s", file.Name(), err)}
+		}
+		game.Ref = logID
+		j, err := json.Marshal(game)
+		fmt.Println(string(j))
+		return err
+	case oFormat == "mjai":
+		err = mjlog.ConvertMJAI(file, os.Stdout)
+		if err != nil {
+			return DataError{fmt.Errorf("Failed to convert %s: %s", file.Name(), err)}
+		}
+		return nil
+	default:
+		return usageErrorf("No such output format, %s", oFormat)
+	}
+}
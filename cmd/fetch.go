@@ -1,66 +1,319 @@
 package cmd
 
 import (
+	"bufio"
 	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/c-14/gtenlog/tenhou"
 	"github.com/c-14/gtenlog/storage"
 )
 
+// FetchError is returned when some downloads failed even though the fetch
+// ran to completion.
+type FetchError struct {
+	Summary *tenhou.FetchSummary
+}
+
+func (e FetchError) Error() string {
+	return fmt.Sprintf("Failed to fetch %d of %d items", len(e.Summary.Failed),
+		e.Summary.Succeeded+e.Summary.Skipped+len(e.Summary.Failed))
+}
+
+// Transient reports whether every failure may go away when retried later.
+func (e FetchError) Transient() bool {
+	for _, failure := range e.Summary.Failed {
+		if !failure.Transient {
+			return false
+		}
+	}
+	return true
+}
+
+func printFetchSummary(summary *tenhou.FetchSummary) {
+	fmt.Fprintf(os.Stderr, "Fetch summary: %s\n", summary)
+	for _, failure := range summary.Failed {
+		fmt.Fprintf(os.Stderr, "\t%s: %s\n", failure.Item, failure.Err)
+	}
+}
+
+func readLogRefs(args []string, idFile string) ([]string, error) {
+	refs := append([]string(nil), args...)
+	if idFile == "" && len(args) > 0 {
+		return refs, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if idFile != "" && idFile != "-" {
+		file, err := os.Open(idFile)
+		if err != nil {
+			return refs, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		for _, field := range strings.Fields(lines.Text()) {
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+			refs = append(refs, field)
+		}
+	}
+	return refs, lines.Err()
+}
+
+// parseLogRefs returns the index entries and logs to fetch for refs, leaving
+// out games not played under rule unless it is empty.
+func parseLogRefs(refs []string, owner string, rule string) ([]storage.TenhouLocalStorage, []storage.UserLogInfo, error) {
+	var entries []storage.TenhouLocalStorage
+	var logs []storage.UserLogInfo
+	seen := make(map[string]bool)
+
+	for _, ref := range refs {
+		id, seat, err := tenhou.ParseLogRef(ref)
+		if err != nil {
+			return entries, logs, err
+		}
+		canonical, err := tenhou.CanonicalLogID(id)
+		if err != nil {
+			return entries, logs, err
+		}
+		if seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
+
+		logID, _ := tenhou.ParseLogID(canonical)
+		if rule != "" && !logID.MatchesRule(rule) {
+			continue
+		}
+		entry := storage.TenhouLocalStorage{
+			Type:  int(logID.Type),
+			Lobby: logID.Lobby,
+			Log:   canonical,
+			Users: []string{owner},
+		}
+		if seat != -1 {
+			entry.Seat = &seat
+		}
+		entries = append(entries, entry)
+		logs = append(logs, storage.UserLogInfo{LogID: id, User: owner})
+	}
+	return entries, logs, nil
+}
+
+// filterRule passes on the logs played under rule, all of them if rule is
+// empty.
+func filterRule(rule string, in chan storage.UserLogInfo, out chan storage.UserLogInfo) {
+	defer close(out)
+	for info := range in {
+		if rule != "" {
+			logID, err := tenhou.ParseLogID(info.LogID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", info.LogID, err)
+				continue
+			}
+			if !logID.MatchesRule(rule) {
+				continue
+			}
+		}
+		out <- info
+	}
+}
+
+func sendUserLogs(infos []storage.UserLogInfo, logs chan storage.UserLogInfo) {
+	defer close(logs)
+	for _, info := range infos {
+		logs <- info
+	}
+}
+
+// hououUsers selects the players whose houou games are fetched, either the
+// alias groups of the given users from userPath or the names themselves.
+// Every game is selected when both are empty.
+func hououUsers(userPath string, players string) (storage.UserListing, error) {
+	var users storage.UserListing
+	us := storage.UserStorage{}
+	if userPath != "" {
+		if err := us.Read(userPath); err != nil {
+			return users, dataErrorf("Error parsing user mapping: %w", err)
+		}
+	}
+	if players != "" {
+		selected := storage.UserStorage{}
+		for _, name := range strings.Split(players, ",") {
+			selected[name] = us[name]
+		}
+		us = selected
+	}
+	users.Parse(us)
+	return users, nil
+}
+
 func Fetch(args []string) error {
 	if len(args) < 2 {
-		return errors.New("usage: grue fetch <fetchType> <log_root> [-s <date>] [-e <date>]")
+		return UsageError{errors.New("usage: grue fetch <fetchType> <log_root> [-s <date>] [-e <date>] [-w <workers>] [-rate <rps>] [-retries <n>] [-u <owner>] [-i <file>] [-r <rule>] [-a <userFile>] [-p <players>] [-config <file>] [-mjlog-url <url>] [-refer-url <url>] [-scraw-url <url>] [-record <dir>|-replay <dir>] [<logID|url>...]")}
 	}
 
 	var fetchType string = args[0]
 	var path string = args[1]
 	var startDate, endDate string
+	var owner, idFile string
+	var userPath, players string
+	var rule string
+	var configFile string
+	var recordDir, replayDir string
+	var flagEndpoints tenhou.Endpoints
+	var workers, burst, retries int
+	var rate float64
 
 	var fetchFlags = flag.NewFlagSet("fetch", flag.ExitOnError)
 	fetchFlags.StringVar(&startDate, "s", getDefaultStartDate(), "First date for which to download daily logs")
 	fetchFlags.StringVar(&endDate, "e", getDefaultEndDate(), "Last date for which to download daily logs")
+	fetchFlags.StringVar(&owner, "u", "", "User directory to store logs fetched by ID under")
+	fetchFlags.StringVar(&idFile, "i", "", "File to read log IDs or URLs from, - for stdin")
+	fetchFlags.StringVar(&rule, "r", "", "Only fetch game logs played under this rule set, e.g. 四鳳南喰赤 or \"Houou Yonma Hanchan Kuitan Aka\"")
+	fetchFlags.StringVar(&userPath, "a", "", "Path to json file containing user/alias mapping, to fetch only their houou games")
+	fetchFlags.StringVar(&players, "p", "", "Comma separated players or users from -a to fetch houou games of")
+	fetchFlags.IntVar(&workers, "w", 4, "Number of concurrent downloads")
+	fetchFlags.Float64Var(&rate, "rate", 2, "Maximum requests per second to tenhou.net, 0 for no limit")
+	fetchFlags.IntVar(&burst, "burst", 4, "Number of requests allowed in a burst above -rate")
+	fetchFlags.IntVar(&retries, "retries", 5, "Number of times to retry a download after a transient failure")
+	fetchFlags.StringVar(&configFile, "config", os.Getenv("GTENLOG_CONFIG"), "JSON file with the mjlog, refer and scraw endpoints to fetch from")
+	fetchFlags.StringVar(&flagEndpoints.MJLog, "mjlog-url", "", "URL prefix game logs are fetched from by appending the log ID")
+	fetchFlags.StringVar(&flagEndpoints.Refer, "refer-url", "", "URL prefix sent as Referer with the log ID appended")
+	fetchFlags.StringVar(&flagEndpoints.SCRAW, "scraw-url", "", "URL of the directory holding list.cgi, dat/ and the scraw zips")
+	fetchFlags.StringVar(&recordDir, "record", "", "Save every HTTP response to this directory")
+	fetchFlags.StringVar(&replayDir, "replay", "", "Serve HTTP responses saved with -record from this directory instead of the network")
 	err := fetchFlags.Parse(args[2:])
 	if err != nil {
 		return err
 	}
+	if recordDir != "" && replayDir != "" {
+		return usageErrorf("-record and -replay can not be used together")
+	}
+	if replayDir != "" {
+		if info, err := os.Stat(replayDir); err != nil {
+			return err
+		} else if !info.IsDir() {
+			return usageErrorf("%s is not a directory", replayDir)
+		}
+	}
 
+	if rule != "" && !tenhou.ValidRule(rule) {
+		return usageErrorf("Unknown rule %q", rule)
+	}
+	japan, _ := time.LoadLocation("Japan")
+	start, err := time.ParseInLocation("2006-01-02", startDate, japan)
+	if err != nil {
+		return usageErrorf("Failed to parse startDate: %s", err)
+	}
+	end, err := time.ParseInLocation("2006-01-02", endDate, japan)
+	if err != nil {
+		return usageErrorf("Failed to parse endDate: %s", err)
+	}
+
+	endpoints, err := tenhou.LoadEndpoints(configFile)
+	if err != nil {
+		return ConfigError{err}
+	}
+	endpoints = endpoints.Override(flagEndpoints)
+	if err = endpoints.Validate(); err != nil {
+		return ConfigError{err}
+	}
+
+	var logNames chan storage.UserLogInfo = make(chan storage.UserLogInfo, 10)
 	var logs chan storage.UserLogInfo = make(chan storage.UserLogInfo, 10)
 	var errChan chan error = make(chan error)
 	var finished chan int = make(chan int, 1)
 
 	archive := storage.LogArchive{PathRoot: path}
+	if err := archive.RemoveTempFiles(); err != nil {
+		return fmt.Errorf("Error removing interrupted downloads: %s", err)
+	}
 
 	var done int = 1
-	conn := tenhou.SetupHTTP()
+	conn := tenhou.SetupHTTP(tenhou.HTTPOptions{Rate: rate, Burst: burst, Record: recordDir, Replay: replayDir})
+	summary := &tenhou.FetchSummary{}
+	ledger, err := archive.ReadFailureLedger()
+	if err != nil {
+		return fmt.Errorf("Error reading failed downloads: %s", err)
+	}
+	opts := tenhou.FetchOptions{Workers: workers, Retries: retries, Summary: summary, Ledger: ledger, Endpoints: endpoints}
 	switch {
 	case fetchType == "user":
-		go archive.GetUserLogNames("*", logs, errChan)
-		go tenhou.FetchGameLogs(conn, archive, logs, errChan, finished)
+		go archive.GetUserLogNames("*", logNames, errChan)
+		go filterRule(rule, logNames, logs)
+		go tenhou.FetchGameLogs(conn, archive, opts, logs, errChan, finished)
+	case fetchType == "ids":
+		if owner == "" {
+			return usageErrorf("fetch ids needs a user directory to store logs under, set with -u <owner>")
+		}
+		refs, err := readLogRefs(fetchFlags.Args(), idFile)
+		if err != nil {
+			return err
+		}
+		entries, infos, err := parseLogRefs(refs, owner, rule)
+		if err != nil {
+			return DataError{err}
+		}
+		err = archive.AddUserLogEntries(owner, entries)
+		if err != nil {
+			return err
+		}
+		go sendUserLogs(infos, logs)
+		go tenhou.FetchGameLogs(conn, archive, opts, logs, errChan, finished)
+	case fetchType == "houou":
+		users, err := hououUsers(userPath, players)
+		if err != nil {
+			return err
+		}
+		go archive.GetHououLogs(start, end, users, logNames, errChan)
+		go filterRule(rule, logNames, logs)
+		go tenhou.FetchGameLogs(conn, archive, opts, logs, errChan, finished)
+	case fetchType == "retry-failed":
+		go tenhou.FetchFailed(conn, archive, opts, errChan, finished)
 	case fetchType == "daily":
-		go tenhou.FetchSCx(conn, archive, startDate, endDate, errChan, finished)
+		go tenhou.FetchSCx(conn, archive, opts, startDate, endDate, errChan, finished)
 	case fetchType == "yearly":
-		go tenhou.FetchSCRAW(conn, archive, errChan, finished)
+		go tenhou.FetchSCRAW(conn, archive, opts, errChan, finished)
 	case fetchType == "all":
-		go archive.GetUserLogNames("*", logs, errChan)
-		go tenhou.FetchGameLogs(conn, archive, logs, errChan, finished)
-		go tenhou.FetchSCx(conn, archive, startDate, endDate, errChan, finished)
-		go tenhou.FetchSCRAW(conn, archive, errChan, finished)
+		go archive.GetUserLogNames("*", logNames, errChan)
+		go filterRule(rule, logNames, logs)
+		go tenhou.FetchGameLogs(conn, archive, opts, logs, errChan, finished)
+		go tenhou.FetchSCx(conn, archive, opts, startDate, endDate, errChan, finished)
+		go tenhou.FetchSCRAW(conn, archive, opts, errChan, finished)
 		done = 3
 	default:
-		return errors.New("fetchType must be one of [user, daily, yearly, all]")
+		return usageErrorf("fetchType must be one of [user, ids, houou, daily, yearly, all, retry-failed]")
 	}
 
 	for {
 		if done == 0 {
+			printFetchSummary(summary)
+			if err = ledger.Write(); err != nil {
+				return err
+			}
+			if len(summary.Failed) > 0 {
+				return FetchError{Summary: summary}
+			}
 			return nil
 		}
 		select {
 		case err := <-errChan:
-			// fmt.Fprintln(os.Stderr, err)
+			printFetchSummary(summary)
+			ledger.Write()
 			return err
 		case <-finished:
 			done--
 		}
 	}
 }
-
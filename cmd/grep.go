@@ -11,7 +11,7 @@ import (
 	"github.com/c-14/gtenlog/storage"
 )
 
-var grepUsage error = errors.New("usage: gtenlog grep [-s <date>] [-e <date>] [-a <userFile>] <lobby> <logRoot>")
+var grepUsage error = UsageError{errors.New("usage: gtenlog grep [-s <date>] [-e <date>] [-a <userFile>] [-players <n>] [-tier <tier>] [-length <length>] [-kuitan <bool>] [-red <bool>] [-fast <bool>] [-filter <expr>] <lobby|logType> <logRoot>")}
 
 func outputLogLine(oFormat string, log storage.SCxLogLine) error {
 	switch {
@@ -27,7 +27,7 @@ func outputLogLine(oFormat string, log storage.SCxLogLine) error {
 		fmt.Println(string(j))
 		return err
 	default:
-		return fmt.Errorf("No such output format, %s", oFormat)
+		return usageErrorf("No such output format, %s", oFormat)
 	}
 }
 
@@ -39,12 +39,22 @@ func Grep(args []string) error {
 	var startDate, endDate string
 	var userPath string
 	var oFormat string
+	var players int
+	var tier, length, kuitan, red, fast string
+	var filterExpr string
 
 	var grepFlags = flag.NewFlagSet("grep", flag.ExitOnError)
 	grepFlags.StringVar(&startDate, "s", "2006-07-01", "First date for which to output data")
 	grepFlags.StringVar(&endDate, "e", getDefaultEndDate(), "Last date for which to output data")
 	grepFlags.StringVar(&userPath, "a", "", "Path to json file containing user/alias mapping")
 	grepFlags.StringVar(&oFormat, "f", "tenhou", "Format used to output results [tenhou/json/jsonlines]")
+	grepFlags.IntVar(&players, "players", 0, "Only output games with this number of players [3/4]")
+	grepFlags.StringVar(&tier, "tier", "", "Only output games on this table tier [ippan/joukyuu/tokujou/houou]")
+	grepFlags.StringVar(&length, "length", "", "Only output games of this length [tonpuu/hanchan]")
+	grepFlags.StringVar(&kuitan, "kuitan", "", "Only output games with or without open tanyao [true/false]")
+	grepFlags.StringVar(&red, "red", "", "Only output games with or without red fives [true/false]")
+	grepFlags.StringVar(&fast, "fast", "", "Only output fast or normal speed games [true/false]")
+	grepFlags.StringVar(&filterExpr, "filter", "", "Only output games matching this filter expression, e.g. 'lobby in (L1234,L5678) and players has all(alice,bob) and mode.length = hanchan'")
 	err := grepFlags.Parse(args)
 	if err != nil {
 		return err
@@ -58,24 +68,37 @@ func Grep(args []string) error {
 
 	users, err := storage.ParseUserFile(userPath)
 	if err != nil {
-		return fmt.Errorf("Error parsing user mapping: %s", err)
+		return dataErrorf("Error parsing user mapping: %w", err)
+	}
+
+	modes, err := storage.NewGameModeFilter(players, tier, length, kuitan, red, fast)
+	if err != nil {
+		return UsageError{err}
+	}
+	filter := storage.AllFilters(modes)
+	if filterExpr != "" {
+		expr, err := storage.ParseFilter(filterExpr)
+		if err != nil {
+			return UsageError{err}
+		}
+		filter = storage.AllFilters(modes, expr)
 	}
 
 	japan, _ := time.LoadLocation("Japan")
 	start, err := time.ParseInLocation("2006-01-02", startDate, japan)
 	if err != nil {
-		return fmt.Errorf("Failed to parse startDate: %s", err)
+		return usageErrorf("Failed to parse startDate: %s", err)
 	}
 	end, err := time.ParseInLocation("2006-01-02", endDate, japan)
 	if err != nil {
-		return fmt.Errorf("Failed to parse endDate: %s", err)
+		return usageErrorf("Failed to parse endDate: %s", err)
 	}
 
 	var logs chan storage.SCxLogLine = make(chan storage.SCxLogLine, 10)
 	var errChan chan error = make(chan error)
 	var finished chan int = make(chan int, 1)
 
-	go archive.GrepLogs(lobby, users, start, end, logs, errChan, finished)
+	go archive.GrepLogs(lobby, users, filter, start, end, logs, errChan, finished)
 
 	if oFormat == "json" {
 		fmt.Println("[")
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c-14/gtenlog/mjlog"
+	"github.com/c-14/gtenlog/storage"
+	"github.com/c-14/gtenlog/tenhou"
+)
+
+var statsUsage error = UsageError{errors.New("usage: gtenlog stats [-s <date>] [-e <date>] [-a <userFile>] [-r <rule>] [-f <format>] [-y] [-houou] <logRoot>")}
+
+type statsOutput struct {
+	Player         string  `json:"player"`
+	Games          int     `json:"games"`
+	Rounds         int     `json:"rounds"`
+	AvgPlacement   float64 `json:"avgPlacement"`
+	Placements     []int   `json:"placements"`
+	WinRate        float64 `json:"winRate"`
+	DealInRate     float64 `json:"dealInRate"`
+	RiichiRate     float64 `json:"riichiRate"`
+	CallRate       float64 `json:"callRate"`
+	AvgWin         float64 `json:"avgWin"`
+	AvgDealIn      float64 `json:"avgDealIn"`
+	DrawTenpaiRate float64 `json:"drawTenpaiRate"`
+}
+
+type yakuOutput struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Count     int     `json:"count"`
+	Rate      float64 `json:"rate"`
+	AvgHan    float64 `json:"avgHan"`
+	AvgPoints float64 `json:"avgPoints"`
+}
+
+type yakuReportOutput struct {
+	Player string         `json:"player"`
+	Wins   int            `json:"wins"`
+	Yaku   []yakuOutput   `json:"yaku"`
+	Limits map[string]int `json:"limits"`
+}
+
+func outputYakuStats(oFormat string, stats mjlog.Stats) error {
+	switch {
+	case oFormat == "text":
+		w := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+		for _, ps := range stats.Sorted() {
+			fmt.Fprintf(w, "%s (%d wins)\n", ps.Name, ps.Wins)
+			fmt.Fprintln(w, "Yaku\tCount\tRate\tAvg Han\tAvg Points")
+			for _, id := range ps.SortedYaku() {
+				ys := ps.Yaku[id]
+				fmt.Fprintf(w, "%s\t%d\t%.1f%%\t%.2f\t%.0f\n", mjlog.YakuName(id), ys.Count,
+					ps.YakuRate(id)*100, ys.AverageHan(), ys.AveragePoints())
+			}
+			for l := mjlog.Mangan; l <= mjlog.Yakuman; l++ {
+				fmt.Fprintf(w, "%s\t%d\t%.1f%%\t\t\n", l, ps.Limits[l], ps.LimitRate(l)*100)
+			}
+			fmt.Fprintln(w)
+		}
+		return w.Flush()
+	case oFormat == "json":
+		out := make([]yakuReportOutput, 0, len(stats))
+		for _, ps := range stats.Sorted() {
+			report := yakuReportOutput{Player: ps.Name, Wins: ps.Wins, Yaku: []yakuOutput{}, Limits: make(map[string]int)}
+			for _, id := range ps.SortedYaku() {
+				ys := ps.Yaku[id]
+				report.Yaku = append(report.Yaku, yakuOutput{
+					ID:        id,
+					Name:      mjlog.YakuName(id),
+					Count:     ys.Count,
+					Rate:      ps.YakuRate(id),
+					AvgHan:    ys.AverageHan(),
+					AvgPoints: ys.AveragePoints(),
+				})
+			}
+			for l := mjlog.Mangan; l <= mjlog.Yakuman; l++ {
+				report.Limits[l.String()] = ps.Limits[l]
+			}
+			out = append(out, report)
+		}
+		j, err := json.Marshal(out)
+		fmt.Println(string(j))
+		return err
+	default:
+		return usageErrorf("No such output format, %s", oFormat)
+	}
+}
+
+func outputStats(oFormat string, stats mjlog.Stats) error {
+	switch {
+	case oFormat == "text":
+		w := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "Player\tGames\tAvg\t1st\t2nd\t3rd\t4th\tWin\tDeal-in\tRiichi\tCall\tAvg Win\tAvg Deal-in\tDraw Tenpai")
+		for _, ps := range stats.Sorted() {
+			fmt.Fprintf(w, "%s\t%d\t%.2f\t%d\t%d\t%d\t%d\t%.1f%%\t%.1f%%\t%.1f%%\t%.1f%%\t%.0f\t%.0f\t%.1f%%\n",
+				ps.Name, ps.Games, ps.AveragePlacement(),
+				ps.Placements[0], ps.Placements[1], ps.Placements[2], ps.Placements[3],
+				ps.WinRate()*100, ps.DealInRate()*100, ps.RiichiRate()*100, ps.CallRate()*100,
+				ps.AverageWin(), ps.AverageDealIn(), ps.DrawTenpaiRate()*100)
+		}
+		return w.Flush()
+	case oFormat == "json":
+		out := make([]statsOutput, 0, len(stats))
+		for _, ps := range stats.Sorted() {
+			out = append(out, statsOutput{
+				Player:         ps.Name,
+				Games:          ps.Games,
+				Rounds:         ps.Rounds,
+				AvgPlacement:   ps.AveragePlacement(),
+				Placements:     ps.Placements[:],
+				WinRate:        ps.WinRate(),
+				DealInRate:     ps.DealInRate(),
+				RiichiRate:     ps.RiichiRate(),
+				CallRate:       ps.CallRate(),
+				AvgWin:         ps.AverageWin(),
+				AvgDealIn:      ps.AverageDealIn(),
+				DrawTenpaiRate: ps.DrawTenpaiRate(),
+			})
+		}
+		j, err := json.Marshal(out)
+		fmt.Println(string(j))
+		return err
+	default:
+		return usageErrorf("No such output format, %s", oFormat)
+	}
+}
+
+// summarizeUserLog returns false without an error for logs that can't be
+// summarized, such as incomplete games.
+func summarizeUserLog(archive storage.LogArchive, info storage.UserLogInfo) (mjlog.GameSummary, bool, error) {
+	file, err := archive.OpenUserLog(info)
+	if err != nil {
+		return mjlog.GameSummary{}, false, err
+	}
+	defer file.Close()
+
+	g, err := mjlog.SummarizeGame(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", file.Name(), err)
+		return g, false, nil
+	}
+	return g, true, nil
+}
+
+// sendGameLogs sends the logs of every user, followed by the houou table
+// games if houou is set.
+func sendGameLogs(archive storage.LogArchive, houou bool, logs chan storage.UserLogInfo, errChan chan error) {
+	defer close(logs)
+
+	userLogs := make(chan storage.UserLogInfo, 10)
+	go archive.GetUserGameLogs("*", userLogs, errChan)
+	for info := range userLogs {
+		logs <- info
+	}
+	if !houou {
+		return
+	}
+
+	hououLogs := make(chan storage.UserLogInfo, 10)
+	go archive.GetHououGameLogs(hououLogs, errChan)
+	for info := range hououLogs {
+		logs <- info
+	}
+}
+
+func Stats(args []string) error {
+	var startDate, endDate string
+	var userPath string
+	var rule string
+	var oFormat string
+	var yaku, houou bool
+
+	var statsFlags = flag.NewFlagSet("stats", flag.ExitOnError)
+	statsFlags.StringVar(&startDate, "s", "2006-07-01", "First date for which to include games")
+	statsFlags.StringVar(&endDate, "e", getDefaultEndDate(), "Last date for which to include games")
+	statsFlags.StringVar(&userPath, "a", "", "Path to json file containing user/alias mapping")
+	statsFlags.StringVar(&rule, "r", "", "Only include games played under this rule set, e.g. 四鳳南喰赤 or \"Houou Yonma Hanchan Kuitan Aka\"")
+	statsFlags.StringVar(&oFormat, "f", "text", "Format used to output results [text/json]")
+	statsFlags.BoolVar(&yaku, "y", false, "Report how often each player wins with each yaku instead")
+	statsFlags.BoolVar(&houou, "houou", false, "Also include the houou table games saved by fetch houou")
+	err := statsFlags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if statsFlags.NArg() != 1 {
+		return statsUsage
+	}
+	if rule != "" && !tenhou.ValidRule(rule) {
+		return usageErrorf("Unknown rule %q", rule)
+	}
+	archive := storage.LogArchive{PathRoot: statsFlags.Arg(0)}
+
+	users, err := storage.ParseUserFile(userPath)
+	if err != nil {
+		return dataErrorf("Error parsing user mapping: %w", err)
+	}
+
+	japan, _ := time.LoadLocation("Japan")
+	start, err := time.ParseInLocation("2006-01-02", startDate, japan)
+	if err != nil {
+		return usageErrorf("Failed to parse startDate: %s", err)
+	}
+	end, err := time.ParseInLocation("2006-01-02", endDate, japan)
+	if err != nil {
+		return usageErrorf("Failed to parse endDate: %s", err)
+	}
+
+	var logs chan storage.UserLogInfo = make(chan storage.UserLogInfo, 10)
+	var errChan chan error = make(chan error)
+
+	go sendGameLogs(archive, houou, logs, errChan)
+
+	stats := make(mjlog.Stats)
+	seen := make(map[string]bool)
+	for {
+		select {
+		case info, ok := <-logs:
+			if !ok {
+				if yaku {
+					return outputYakuStats(oFormat, stats)
+				}
+				return outputStats(oFormat, stats)
+			}
+			if seen[info.LogID] {
+				continue
+			}
+			seen[info.LogID] = true
+
+			logID, err := tenhou.ParseLogID(info.LogID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", info.LogID, err)
+				continue
+			}
+			if logID.Date().Before(start) || logID.Date().After(end) {
+				continue
+			}
+			if rule != "" && !logID.MatchesRule(rule) {
+				continue
+			}
+
+			g, ok, err := summarizeUserLog(archive, info)
+			if err != nil {
+				return err
+			}
+			if ok {
+				stats.Add(g, users.User)
+			}
+		case err = <-errChan:
+			return err
+		}
+	}
+}
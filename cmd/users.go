@@ -19,7 +19,7 @@ Subcommands:
 
 func addUser(userFilePath string, args []string) error {
 	if len(args) < 1 {
-		return errors.New("usage: grue users add <username> [<aliasName>...]")
+		return UsageError{errors.New("usage: grue users add <username> [<aliasName>...]")}
 	}
 
 	var username string = args[0]
@@ -28,7 +28,7 @@ func addUser(userFilePath string, args []string) error {
 	var users storage.UserStorage = make(storage.UserStorage)
 	err := users.Read(userFilePath)
 	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("Error opening user/alias mapping: %s", err)
+		return dataErrorf("Error opening user/alias mapping: %w", err)
 	}
 
 	err = users.AddUser(username, aliases)
@@ -41,7 +41,7 @@ func addUser(userFilePath string, args []string) error {
 
 func addAlias(userFilePath string, args []string) error {
 	if len(args) < 1 {
-		return errors.New("usage: grue users addAlias <username> <aliasName>...")
+		return UsageError{errors.New("usage: grue users addAlias <username> <aliasName>...")}
 	}
 
 	var username string = args[0]
@@ -50,7 +50,7 @@ func addAlias(userFilePath string, args []string) error {
 	var users storage.UserStorage = make(storage.UserStorage)
 	err := users.Read(userFilePath)
 	if err != nil {
-		return fmt.Errorf("Error opening user/alias mapping: %s", err)
+		return dataErrorf("Error opening user/alias mapping: %w", err)
 	}
 
 	err = users.AddAliases(username, aliases)
@@ -63,13 +63,13 @@ func addAlias(userFilePath string, args []string) error {
 
 func listUsers(userFilePath string, args []string) error {
 	if len(args) != 0 {
-		return errors.New("usage: grue users list")
+		return UsageError{errors.New("usage: grue users list")}
 	}
 
 	var users storage.UserStorage = make(storage.UserStorage)
 	err := users.Read(userFilePath)
 	if err != nil {
-		return fmt.Errorf("Error opening user/alias mapping: %s", err)
+		return dataErrorf("Error opening user/alias mapping: %w", err)
 	}
 
 	fmt.Println(users)
@@ -79,7 +79,7 @@ func listUsers(userFilePath string, args []string) error {
 
 func Users(args []string) error {
 	if len(args) < 2 {
-		return fmt.Errorf(userUsage())
+		return UsageError{errors.New(userUsage())}
 	}
 
 	var err error
@@ -87,7 +87,7 @@ func Users(args []string) error {
 	case "-h":
 		fallthrough
 	case "--help":
-		return fmt.Errorf(userUsage())
+		return UsageError{errors.New(userUsage())}
 	default:
 		userFilePath := arg
 		switch command := args[1]; command {
@@ -100,7 +100,7 @@ func Users(args []string) error {
 		case "list":
 			err = listUsers(userFilePath, args[2:])
 		default:
-			return fmt.Errorf(userUsage())
+			return UsageError{errors.New(userUsage())}
 		}
 	}
 	return err
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -10,12 +11,20 @@ import (
 const version = "0.1.0-beta"
 
 func usage() string {
-	return `usage: gtenlog [--help] {scrape|fetch|aggregate} ...
+	return `usage: gtenlog [--help] {scrape|fetch|aggregate|stats|export} ...
 
 Subcommands:
 	scrape <webappstore.sqlite> <output_path>
-	fetch <fetchType> <log_root> [-s <date>] [-e <date>]
-	aggregate <log_root>
+	fetch <fetchType> <log_root> [-s <date>] [-e <date>] [-r <rule>] [-w <workers>] [-rate <rps>] [-burst <n>] [-retries <n>]
+		[-config <file>] [-mjlog-url <url>] [-refer-url <url>] [-scraw-url <url>]
+		[-record <dir>|-replay <dir>]
+	fetch ids <log_root> -u <owner> [-i <file>] [<log_id|url>...]
+	fetch houou <log_root> [-s <date>] [-e <date>] [-a <userFile>] [-p <players>]
+	fetch retry-failed <log_root>
+	aggregate <log_root> [-t <types>] [-c <date>|-age <days>] [-attic] [-dry-run]
+	aggregate <log_root> -check
+	stats [-s <date>] [-e <date>] [-a <userFile>] [-r <rule>] [-y] [-houou] <log_root>
+	export [-f <format>] [-l <log_root>] <log_id|path>
 	users <userFile> {add|addAlias|list}
 	`
 }
@@ -35,6 +44,10 @@ func main() {
 		err = cmd.Aggregate(os.Args[2:])
 	case "grep":
 		err = cmd.Grep(os.Args[2:])
+	case "stats":
+		err = cmd.Stats(os.Args[2:])
+	case "export":
+		err = cmd.Export(os.Args[2:])
 	case "users":
 		err = cmd.Users(os.Args[2:])
 	case "-v":
@@ -51,5 +64,33 @@ func main() {
 	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func exitCode(err error) int {
+	var fetchErr cmd.FetchError
+	var usageErr cmd.UsageError
+	var configErr cmd.ConfigError
+	var dataErr cmd.DataError
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	switch {
+	case errors.As(err, &fetchErr):
+		if fetchErr.Transient() {
+			return EX_TEMPFAIL
+		}
+		return EX_UNAVAILABLE
+	case errors.As(err, &usageErr):
+		return EX_USAGE
+	case errors.As(err, &configErr):
+		return EX_CONFIG
+	case errors.As(err, &pathErr), errors.As(err, &linkErr), errors.As(err, &syscallErr):
+		return EX_IOERR
+	case errors.As(err, &dataErr):
+		return EX_DATAERR
+	default:
+		return EX_SOFTWARE
 	}
 }
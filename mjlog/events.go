@@ -0,0 +1,131 @@
+package mjlog
+
+type Event interface {
+	Tag() string
+}
+
+type Shuffle struct {
+	Seed string
+	Ref  string
+}
+
+type Go struct {
+	Type  GameType
+	Lobby int
+}
+
+type Un struct {
+	Names [4]string
+	Dan   [4]int
+	Rate  [4]float64
+	Sex   [4]string
+	// Reconnect is set for the UN tag Tenhou writes when a player rejoins;
+	// only that player's name is present.
+	Reconnect bool
+}
+
+type Taikyoku struct {
+	Oya int
+}
+
+// Scores in Init, Reach, Agari, Ryuukyoku and Owari are in points, not in
+// the hundreds Tenhou stores them as.
+type Init struct {
+	Round         int
+	Honba         int
+	Riichi        int
+	Dice          [2]int
+	DoraIndicator Tile
+	Scores        [4]int
+	Oya           int
+	Hands         [4][]Tile
+}
+
+type Draw struct {
+	Who  int
+	Tile Tile
+}
+
+type Discard struct {
+	Who  int
+	Tile Tile
+}
+
+type Call struct {
+	Who  int
+	Meld Meld
+}
+
+type Reach struct {
+	Who    int
+	Step   int
+	Scores [4]int
+}
+
+type Dora struct {
+	Tile Tile
+}
+
+type YakuHan struct {
+	ID  int
+	Han int
+}
+
+type Agari struct {
+	Who            int
+	FromWho        int
+	PaoWho         int
+	Honba          int
+	Riichi         int
+	Hand           []Tile
+	Melds          []Meld
+	Machi          Tile
+	Fu             int
+	Points         int
+	Limit          Limit
+	Yaku           []YakuHan
+	Yakuman        []int
+	DoraIndicators []Tile
+	UraIndicators  []Tile
+	Scores         [4]int
+	Deltas         [4]int
+}
+
+type Ryuukyoku struct {
+	Type   string
+	Honba  int
+	Riichi int
+	Scores [4]int
+	Deltas [4]int
+	// Hands holds the hands shown at the draw, nil for seats that did not
+	// show theirs.
+	Hands [4][]Tile
+}
+
+type Bye struct {
+	Who int
+}
+
+type Owari struct {
+	Scores [4]int
+	Points [4]float64
+}
+
+func (Shuffle) Tag() string   { return "SHUFFLE" }
+func (Go) Tag() string        { return "GO" }
+func (Un) Tag() string        { return "UN" }
+func (Taikyoku) Tag() string  { return "TAIKYOKU" }
+func (Init) Tag() string      { return "INIT" }
+func (Draw) Tag() string      { return "T" }
+func (Discard) Tag() string   { return "D" }
+func (Call) Tag() string      { return "N" }
+func (Reach) Tag() string     { return "REACH" }
+func (Dora) Tag() string      { return "DORA" }
+func (Agari) Tag() string     { return "AGARI" }
+func (Ryuukyoku) Tag() string { return "RYUUKYOKU" }
+func (Bye) Tag() string       { return "BYE" }
+func (Owari) Tag() string     { return "owari" }
+
+func (a Agari) Tsumo() bool {
+	return a.Who == a.FromWho
+}
@@ -0,0 +1,121 @@
+package mjlog
+
+import (
+	"strings"
+)
+
+type GameType int
+
+const (
+	TypeOnline   GameType = 0x01
+	TypeNoRed    GameType = 0x02
+	TypeNoKuitan GameType = 0x04
+	TypeHanchan  GameType = 0x08
+	TypeSanma    GameType = 0x10
+	TypeTokujou  GameType = 0x20
+	TypeFast     GameType = 0x40
+	TypeJoukyuu  GameType = 0x80
+	TypeHouou    GameType = TypeTokujou | TypeJoukyuu
+	typeTierMask GameType = TypeTokujou | TypeJoukyuu
+)
+
+func (g GameType) Players() int {
+	if g&TypeSanma != 0 {
+		return 3
+	}
+	return 4
+}
+
+func (g GameType) Hanchan() bool {
+	return g&TypeHanchan != 0
+}
+
+func (g GameType) Red() bool {
+	return g&TypeNoRed == 0
+}
+
+func (g GameType) Kuitan() bool {
+	return g&TypeNoKuitan == 0
+}
+
+func (g GameType) Fast() bool {
+	return g&TypeFast != 0
+}
+
+func (g GameType) Tier() GameType {
+	return g & typeTierMask
+}
+
+// String renders the type the way Tenhou labels tables, e.g. 四鳳南喰赤.
+func (g GameType) String() string {
+	var b strings.Builder
+	if g.Players() == 3 {
+		b.WriteRune('三')
+	} else {
+		b.WriteRune('四')
+	}
+	switch g.Tier() {
+	case TypeHouou:
+		b.WriteRune('鳳')
+	case TypeTokujou:
+		b.WriteRune('特')
+	case TypeJoukyuu:
+		b.WriteRune('上')
+	default:
+		b.WriteRune('般')
+	}
+	if g.Hanchan() {
+		b.WriteRune('南')
+	} else {
+		b.WriteRune('東')
+	}
+	if g.Kuitan() {
+		b.WriteRune('喰')
+	}
+	if g.Red() {
+		b.WriteRune('赤')
+	}
+	if g.Fast() {
+		b.WriteRune('速')
+	}
+	return b.String()
+}
+
+func (g GameType) TierName() string {
+	switch g.Tier() {
+	case TypeHouou:
+		return "Houou"
+	case TypeTokujou:
+		return "Tokujou"
+	case TypeJoukyuu:
+		return "Joukyuu"
+	default:
+		return "Ippan"
+	}
+}
+
+// Name renders the type as a readable rule name, e.g.
+// "Houou Yonma Hanchan Kuitan Aka".
+func (g GameType) Name() string {
+	fields := []string{g.TierName()}
+	if g.Players() == 3 {
+		fields = append(fields, "Sanma")
+	} else {
+		fields = append(fields, "Yonma")
+	}
+	if g.Hanchan() {
+		fields = append(fields, "Hanchan")
+	} else {
+		fields = append(fields, "Tonpuu")
+	}
+	if g.Kuitan() {
+		fields = append(fields, "Kuitan")
+	}
+	if g.Red() {
+		fields = append(fields, "Aka")
+	}
+	if g.Fast() {
+		fields = append(fields, "Fast")
+	}
+	return strings.Join(fields, " ")
+}
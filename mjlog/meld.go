@@ -0,0 +1,95 @@
+package mjlog
+
+type MeldType int
+
+const (
+	Chi MeldType = iota
+	Pon
+	Kakan
+	Daiminkan
+	Ankan
+	Nuki
+)
+
+func (m MeldType) String() string {
+	switch m {
+	case Chi:
+		return "chi"
+	case Pon:
+		return "pon"
+	case Kakan:
+		return "kakan"
+	case Daiminkan:
+		return "daiminkan"
+	case Ankan:
+		return "ankan"
+	case Nuki:
+		return "nuki"
+	default:
+		return "unknown"
+	}
+}
+
+type Meld struct {
+	Type    MeldType
+	Who     int
+	FromWho int
+	Tiles   []Tile
+	Called  Tile
+	// Added is the tile moved from the hand to turn a pon into a kakan.
+	Added Tile
+	Code  int
+}
+
+func DecodeMeld(who int, m int) Meld {
+	meld := Meld{Who: who, FromWho: (who + m&3) % 4, Code: m, Added: -1}
+
+	switch {
+	case m&0x4 != 0:
+		t := m >> 10
+		r := t % 3
+		t /= 3
+		base := (t/7*9 + t%7) * 4
+		meld.Type = Chi
+		meld.Tiles = []Tile{
+			Tile(base + (m>>3)&3),
+			Tile(base + 4 + (m>>5)&3),
+			Tile(base + 8 + (m>>7)&3),
+		}
+		meld.Called = meld.Tiles[r]
+	case m&0x18 != 0:
+		unused := (m >> 5) & 3
+		t := m >> 9
+		r := t % 3
+		base := t / 3 * 4
+		for i := 0; i < 4; i++ {
+			if i != unused {
+				meld.Tiles = append(meld.Tiles, Tile(base+i))
+			}
+		}
+		meld.Called = meld.Tiles[r]
+		if m&0x8 != 0 {
+			meld.Type = Pon
+		} else {
+			meld.Type = Kakan
+			meld.Added = Tile(base + unused)
+			meld.Tiles = append(meld.Tiles, meld.Added)
+		}
+	case m&0x20 != 0:
+		meld.Type = Nuki
+		meld.FromWho = who
+		meld.Called = Tile(m >> 8)
+		meld.Tiles = []Tile{meld.Called}
+	default:
+		hai := m >> 8
+		base := hai / 4 * 4
+		meld.Tiles = []Tile{Tile(base), Tile(base + 1), Tile(base + 2), Tile(base + 3)}
+		meld.Called = Tile(hai)
+		if m&3 == 0 {
+			meld.Type = Ankan
+		} else {
+			meld.Type = Daiminkan
+		}
+	}
+	return meld
+}
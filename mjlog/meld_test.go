@@ -0,0 +1,36 @@
+package mjlog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeMeld(t *testing.T) {
+	tests := []struct {
+		m    int
+		meld Meld
+	}{
+		// 2m3m4m called from the left, 2m taken
+		{3<<10 | 2<<7 | 1<<5 | 0x4 | 3,
+			Meld{Type: Chi, Who: 1, FromWho: 0, Tiles: []Tile{4, 9, 14}, Called: 4, Added: -1}},
+		// 5p called from across, red 5p left in the hand
+		{41<<9 | 1<<5 | 0x8 | 2,
+			Meld{Type: Pon, Who: 1, FromWho: 3, Tiles: []Tile{52, 54, 55}, Called: 55, Added: -1}},
+		// the same pon with the red 5p added
+		{41<<9 | 1<<5 | 0x10 | 2,
+			Meld{Type: Kakan, Who: 1, FromWho: 3, Tiles: []Tile{52, 54, 55, 53}, Called: 55, Added: 53}},
+		// east called from the right
+		{108<<8 | 1,
+			Meld{Type: Daiminkan, Who: 1, FromWho: 2, Tiles: []Tile{108, 109, 110, 111}, Called: 108, Added: -1}},
+		{108 << 8,
+			Meld{Type: Ankan, Who: 1, FromWho: 1, Tiles: []Tile{108, 109, 110, 111}, Called: 108, Added: -1}},
+		{120<<8 | 0x20,
+			Meld{Type: Nuki, Who: 1, FromWho: 1, Tiles: []Tile{120}, Called: 120, Added: -1}},
+	}
+	for _, test := range tests {
+		test.meld.Code = test.m
+		if meld := DecodeMeld(1, test.m); !reflect.DeepEqual(meld, test.meld) {
+			t.Errorf("DecodeMeld(1, %d) = %+v, want %+v", test.m, meld, test.meld)
+		}
+	}
+}
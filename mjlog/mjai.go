@@ -0,0 +1,236 @@
+package mjlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// MJAIEvent is a single message of the MJAI protocol.
+type MJAIEvent map[string]interface{}
+
+var mjaiHonors = []string{"E", "S", "W", "N", "P", "F", "C"}
+
+func MJAITile(t Tile, red bool) string {
+	if t.Suit() == Honor {
+		return mjaiHonors[t.Number()-1]
+	}
+	s := strconv.Itoa(t.Number()) + string("mps"[t.Suit()])
+	if red && t.IsRed() {
+		s += "r"
+	}
+	return s
+}
+
+var mjaiWinds = []string{"E", "S", "W", "N"}
+
+var mjaiRyuukyokuReasons = map[string]string{
+	"":       "fanpai",
+	"yao9":   "kyushukyuhai",
+	"reach4": "suchareach",
+	"ron3":   "sanchaho",
+	"kan4":   "sukaikan",
+	"kaze4":  "sufonrenta",
+	"nm":     "nagashimangan",
+}
+
+type mjaiConverter struct {
+	red      bool
+	players  int
+	lastDraw [4]Tile
+	scores   [4]int
+	inRound  bool
+	events   []MJAIEvent
+}
+
+func (c *mjaiConverter) tile(t Tile) string {
+	return MJAITile(t, c.red)
+}
+
+func (c *mjaiConverter) tiles(tiles []Tile) []string {
+	ret := make([]string, 0, len(tiles))
+	for _, t := range tiles {
+		ret = append(ret, c.tile(t))
+	}
+	return ret
+}
+
+func (c *mjaiConverter) emit(ev MJAIEvent) {
+	c.events = append(c.events, ev)
+}
+
+func (c *mjaiConverter) endRound() {
+	if c.inRound {
+		c.emit(MJAIEvent{"type": "end_kyoku"})
+		c.inRound = false
+	}
+}
+
+func (c *mjaiConverter) apply(ev Event) {
+	switch v := ev.(type) {
+	case *Go:
+		c.red = v.Type.Red()
+		c.players = v.Type.Players()
+	case *Un:
+		if !v.Reconnect {
+			c.emit(MJAIEvent{"type": "start_game", "names": v.Names[:c.players], "aka_flag": c.red})
+		}
+	case *Init:
+		c.endRound()
+		c.inRound = true
+		c.scores = v.Scores
+		var tehais [][]string
+		for i := 0; i < c.players; i++ {
+			c.lastDraw[i] = -1
+			tehais = append(tehais, c.tiles(v.Hands[i]))
+		}
+		c.emit(MJAIEvent{
+			"type":        "start_kyoku",
+			"bakaze":      mjaiWinds[(v.Round/4)%4],
+			"kyoku":       v.Round%4 + 1,
+			"honba":       v.Honba,
+			"kyotaku":     v.Riichi,
+			"oya":         v.Oya,
+			"dora_marker": c.tile(v.DoraIndicator),
+			"scores":      v.Scores[:c.players],
+			"tehais":      tehais,
+		})
+	case *Draw:
+		c.lastDraw[v.Who] = v.Tile
+		c.emit(MJAIEvent{"type": "tsumo", "actor": v.Who, "pai": c.tile(v.Tile)})
+	case *Discard:
+		c.emit(MJAIEvent{
+			"type":      "dahai",
+			"actor":     v.Who,
+			"pai":       c.tile(v.Tile),
+			"tsumogiri": v.Tile == c.lastDraw[v.Who],
+		})
+		c.lastDraw[v.Who] = -1
+	case *Call:
+		c.applyCall(v)
+	case *Reach:
+		if v.Step == 1 {
+			c.emit(MJAIEvent{"type": "reach", "actor": v.Who})
+		} else if v.Step == 2 {
+			deltas := make([]int, c.players)
+			deltas[v.Who] = -1000
+			if v.Scores != [4]int{} {
+				c.scores = v.Scores
+			} else {
+				c.scores[v.Who] -= 1000
+			}
+			c.emit(MJAIEvent{
+				"type":   "reach_accepted",
+				"actor":  v.Who,
+				"deltas": deltas,
+				"scores": c.scores[:c.players],
+			})
+		}
+	case *Dora:
+		c.emit(MJAIEvent{"type": "dora", "dora_marker": c.tile(v.Tile)})
+	case *Agari:
+		for i := range c.scores {
+			c.scores[i] = v.Scores[i] + v.Deltas[i]
+		}
+		c.emit(MJAIEvent{
+			"type":            "hora",
+			"actor":           v.Who,
+			"target":          v.FromWho,
+			"pai":             c.tile(v.Machi),
+			"hora_tehais":     c.tiles(v.Hand),
+			"uradora_markers": c.tiles(v.UraIndicators),
+			"fu":              v.Fu,
+			"fan":             v.Han(),
+			"hora_points":     v.Points,
+			"deltas":          v.Deltas[:c.players],
+			"scores":          c.scores[:c.players],
+		})
+	case *Ryuukyoku:
+		reason, ok := mjaiRyuukyokuReasons[v.Type]
+		if !ok {
+			reason = v.Type
+		}
+		var tehais [][]string
+		var tenpais []bool
+		for i := 0; i < c.players; i++ {
+			c.scores[i] = v.Scores[i] + v.Deltas[i]
+			tenpais = append(tenpais, v.Hands[i] != nil)
+			if v.Hands[i] != nil {
+				tehais = append(tehais, c.tiles(v.Hands[i]))
+			} else {
+				tehais = append(tehais, []string{})
+			}
+		}
+		c.emit(MJAIEvent{
+			"type":    "ryukyoku",
+			"reason":  reason,
+			"tehais":  tehais,
+			"tenpais": tenpais,
+			"deltas":  v.Deltas[:c.players],
+			"scores":  c.scores[:c.players],
+		})
+	case *Owari:
+		c.endRound()
+		c.emit(MJAIEvent{"type": "end_game", "scores": v.Scores[:c.players]})
+	}
+}
+
+func (c *mjaiConverter) applyCall(v *Call) {
+	m := v.Meld
+	var consumed []string
+	for _, t := range m.Tiles {
+		if t != m.Called {
+			consumed = append(consumed, c.tile(t))
+		}
+	}
+	ev := MJAIEvent{"type": m.Type.String(), "actor": v.Who}
+	switch m.Type {
+	case Chi, Pon, Daiminkan:
+		ev["target"] = m.FromWho
+		ev["pai"] = c.tile(m.Called)
+		ev["consumed"] = consumed
+	case Kakan:
+		consumed = nil
+		for _, t := range m.Tiles {
+			if t != m.Added {
+				consumed = append(consumed, c.tile(t))
+			}
+		}
+		ev["pai"] = c.tile(m.Added)
+		ev["consumed"] = consumed
+	case Ankan:
+		ev["consumed"] = c.tiles(m.Tiles)
+	case Nuki:
+		ev["type"] = "nukidora"
+		ev["pai"] = c.tile(m.Called)
+	}
+	c.lastDraw[v.Who] = -1
+	c.emit(ev)
+}
+
+// ConvertMJAI reads an mjlog and writes it to w as MJAI jsonlines.
+func ConvertMJAI(r io.Reader, w io.Writer) error {
+	c := mjaiConverter{players: 4}
+
+	p, err := InitParser(r)
+	if err != nil {
+		return err
+	}
+
+	wr := bufio.NewWriter(w)
+	enc := json.NewEncoder(wr)
+	for p.Scan() {
+		c.apply(p.Token())
+		for _, ev := range c.events {
+			if err = enc.Encode(ev); err != nil {
+				return err
+			}
+		}
+		c.events = c.events[:0]
+	}
+	if err = p.Err(); err != nil {
+		return err
+	}
+	return wr.Flush()
+}
@@ -0,0 +1,46 @@
+package mjlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertMJAIRiichi(t *testing.T) {
+	file := openTestLog(t, "riichi.xml")
+	defer file.Close()
+
+	var b bytes.Buffer
+	if err := ConvertMJAI(file, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var ev MJAIEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("Invalid event %s: %s", line, err)
+		}
+		switch ev["type"] {
+		case "reach":
+			got = append(got, fmt.Sprintf("reach %v", ev["actor"]))
+		case "dahai":
+			got = append(got, line)
+		}
+	}
+	want := []string{
+		`{"actor":0,"pai":"7p","tsumogiri":true,"type":"dahai"}`,
+		`{"actor":1,"pai":"1m","tsumogiri":false,"type":"dahai"}`,
+		"reach 2",
+		`{"actor":2,"pai":"7p","tsumogiri":true,"type":"dahai"}`,
+		"reach 3",
+		`{"actor":3,"pai":"1m","tsumogiri":false,"type":"dahai"}`,
+		`{"actor":0,"pai":"1m","tsumogiri":false,"type":"dahai"}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got discards\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
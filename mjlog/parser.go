@@ -0,0 +1,350 @@
+package mjlog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type Parser struct {
+	Version string
+
+	d       *xml.Decoder
+	pending []Event
+	t       Event
+	e       error
+}
+
+func InitParser(r io.Reader) (p Parser, err error) {
+	p.d = xml.NewDecoder(r)
+	err = p.consumeHeader()
+	return
+}
+
+func (p *Parser) consumeHeader() error {
+	for {
+		tok, err := p.d.Token()
+		if err != nil {
+			return err
+		}
+		switch v := tok.(type) {
+		case xml.StartElement:
+			if v.Name.Local != "mjloggm" {
+				return fmt.Errorf("mjlog begins with an invalid element: %s", v.Name.Local)
+			}
+			p.Version = attrs(v.Attr).get("ver")
+			return nil
+		case xml.ProcInst, xml.CharData, xml.Comment, xml.Directive:
+			continue
+		}
+	}
+}
+
+func (p *Parser) Err() error {
+	return p.e
+}
+
+func (p *Parser) Token() Event {
+	return p.t
+}
+
+func (p *Parser) Scan() bool {
+	if len(p.pending) > 0 {
+		p.t = p.pending[0]
+		p.pending = p.pending[1:]
+		return true
+	}
+	for {
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			return false
+		} else if err != nil {
+			p.e = err
+			return false
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		events, err := parseElement(start)
+		if err != nil {
+			p.e = fmt.Errorf("Failed parsing %s: %s", start.Name.Local, err)
+			return false
+		}
+		p.t = events[0]
+		p.pending = events[1:]
+		return true
+	}
+}
+
+type attrs []xml.Attr
+
+func (a attrs) get(name string) string {
+	for _, attr := range a {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (a attrs) has(name string) bool {
+	for _, attr := range a {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+type attrParser struct {
+	a   attrs
+	err error
+}
+
+func (ap *attrParser) int(name string, def int) int {
+	s := ap.a.get(name)
+	if s == "" || ap.err != nil {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		ap.err = fmt.Errorf("attribute %s: %s", name, err)
+	}
+	return n
+}
+
+func (ap *attrParser) ints(name string) []int {
+	s := ap.a.get(name)
+	if s == "" || ap.err != nil {
+		return nil
+	}
+	fields := strings.Split(s, ",")
+	ret := make([]int, len(fields))
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			ap.err = fmt.Errorf("attribute %s: %s", name, err)
+			return nil
+		}
+		ret[i] = n
+	}
+	return ret
+}
+
+func (ap *attrParser) tiles(name string) []Tile {
+	if ap.err != nil {
+		return nil
+	}
+	tiles, err := parseTiles(ap.a.get(name))
+	if err != nil {
+		ap.err = fmt.Errorf("attribute %s: %s", name, err)
+	}
+	return tiles
+}
+
+func (ap *attrParser) scores(name string) [4]int {
+	var scores [4]int
+	for i, n := range ap.ints(name) {
+		if i < 4 {
+			scores[i] = n * 100
+		}
+	}
+	return scores
+}
+
+func (ap *attrParser) scoreDeltas(name string) (scores [4]int, deltas [4]int) {
+	sc := ap.ints(name)
+	for i := 0; i+1 < len(sc) && i < 8; i += 2 {
+		scores[i/2] = sc[i] * 100
+		deltas[i/2] = sc[i+1] * 100
+	}
+	return
+}
+
+func (ap *attrParser) owari() (Event, bool) {
+	s := ap.a.get("owari")
+	if s == "" {
+		return nil, false
+	}
+	var o Owari
+	fields := strings.Split(s, ",")
+	for i := 0; i+1 < len(fields) && i < 8; i += 2 {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			ap.err = fmt.Errorf("attribute owari: %s", err)
+			return nil, false
+		}
+		pt, err := strconv.ParseFloat(fields[i+1], 64)
+		if err != nil {
+			ap.err = fmt.Errorf("attribute owari: %s", err)
+			return nil, false
+		}
+		o.Scores[i/2] = n * 100
+		o.Points[i/2] = pt
+	}
+	return &o, true
+}
+
+func seatTag(name string, seats string) (int, int, bool) {
+	if len(name) < 2 {
+		return 0, 0, false
+	}
+	who := strings.IndexByte(seats, name[0])
+	if who == -1 {
+		return 0, 0, false
+	}
+	tile, err := strconv.Atoi(name[1:])
+	if err != nil || tile < 0 || tile > 135 {
+		return 0, 0, false
+	}
+	return who, tile, true
+}
+
+func parseElement(start xml.StartElement) ([]Event, error) {
+	name := start.Name.Local
+	ap := attrParser{a: attrs(start.Attr)}
+
+	if who, tile, ok := seatTag(name, "TUVW"); ok {
+		return []Event{&Draw{Who: who, Tile: Tile(tile)}}, nil
+	}
+	if who, tile, ok := seatTag(name, "DEFG"); ok {
+		return []Event{&Discard{Who: who, Tile: Tile(tile)}}, nil
+	}
+
+	var ev Event
+	var events []Event
+	switch name {
+	case "SHUFFLE":
+		ev = &Shuffle{Seed: ap.a.get("seed"), Ref: ap.a.get("ref")}
+	case "GO":
+		ev = &Go{Type: GameType(ap.int("type", 0)), Lobby: ap.int("lobby", 0)}
+	case "UN":
+		ev = parseUn(&ap)
+	case "TAIKYOKU":
+		ev = &Taikyoku{Oya: ap.int("oya", 0)}
+	case "INIT":
+		ev = parseInit(&ap)
+	case "N":
+		who := ap.int("who", 0)
+		ev = &Call{Who: who, Meld: DecodeMeld(who, ap.int("m", 0))}
+	case "REACH":
+		ev = &Reach{Who: ap.int("who", 0), Step: ap.int("step", 0), Scores: ap.scores("ten")}
+	case "DORA":
+		ev = &Dora{Tile: Tile(ap.int("hai", 0))}
+	case "AGARI":
+		ev = parseAgari(&ap)
+	case "RYUUKYOKU":
+		ev = parseRyuukyoku(&ap)
+	case "BYE":
+		ev = &Bye{Who: ap.int("who", 0)}
+	default:
+		return nil, fmt.Errorf("Unknown tag %s", name)
+	}
+	events = append(events, ev)
+	if o, ok := ap.owari(); ok {
+		events = append(events, o)
+	}
+	if ap.err != nil {
+		return nil, ap.err
+	}
+	return events, nil
+}
+
+func parseUn(ap *attrParser) *Un {
+	var un Un
+	for i := 0; i < 4; i++ {
+		name, err := url.PathUnescape(ap.a.get("n" + strconv.Itoa(i)))
+		if err != nil && ap.err == nil {
+			ap.err = fmt.Errorf("attribute n%d: %s", i, err)
+		}
+		un.Names[i] = name
+	}
+	un.Reconnect = !ap.a.has("dan")
+	for i, n := range ap.ints("dan") {
+		if i < 4 {
+			un.Dan[i] = n
+		}
+	}
+	for i, s := range strings.Split(ap.a.get("rate"), ",") {
+		if i >= 4 || s == "" {
+			break
+		}
+		r, err := strconv.ParseFloat(s, 64)
+		if err != nil && ap.err == nil {
+			ap.err = fmt.Errorf("attribute rate: %s", err)
+		}
+		un.Rate[i] = r
+	}
+	for i, s := range strings.Split(ap.a.get("sx"), ",") {
+		if i < 4 {
+			un.Sex[i] = s
+		}
+	}
+	return &un
+}
+
+func parseInit(ap *attrParser) *Init {
+	var init Init
+	seed := ap.ints("seed")
+	if len(seed) != 6 {
+		if ap.err == nil {
+			ap.err = fmt.Errorf("attribute seed: expected 6 fields, got %d", len(seed))
+		}
+		return &init
+	}
+	init.Round = seed[0]
+	init.Honba = seed[1]
+	init.Riichi = seed[2]
+	init.Dice = [2]int{seed[3], seed[4]}
+	init.DoraIndicator = Tile(seed[5])
+	init.Scores = ap.scores("ten")
+	init.Oya = ap.int("oya", 0)
+	for i := 0; i < 4; i++ {
+		init.Hands[i] = ap.tiles("hai" + strconv.Itoa(i))
+	}
+	return &init
+}
+
+func parseAgari(ap *attrParser) *Agari {
+	var agari Agari
+	agari.Who = ap.int("who", 0)
+	agari.FromWho = ap.int("fromWho", 0)
+	agari.PaoWho = ap.int("paoWho", -1)
+	if ba := ap.ints("ba"); len(ba) == 2 {
+		agari.Honba, agari.Riichi = ba[0], ba[1]
+	}
+	agari.Hand = ap.tiles("hai")
+	for _, m := range ap.ints("m") {
+		agari.Melds = append(agari.Melds, DecodeMeld(agari.Who, m))
+	}
+	agari.Machi = Tile(ap.int("machi", 0))
+	if ten := ap.ints("ten"); len(ten) == 3 {
+		agari.Fu, agari.Points, agari.Limit = ten[0], ten[1], Limit(ten[2])
+	}
+	yaku := ap.ints("yaku")
+	for i := 0; i+1 < len(yaku); i += 2 {
+		agari.Yaku = append(agari.Yaku, YakuHan{ID: yaku[i], Han: yaku[i+1]})
+	}
+	agari.Yakuman = ap.ints("yakuman")
+	agari.DoraIndicators = ap.tiles("doraHai")
+	agari.UraIndicators = ap.tiles("doraHaiUra")
+	agari.Scores, agari.Deltas = ap.scoreDeltas("sc")
+	return &agari
+}
+
+func parseRyuukyoku(ap *attrParser) *Ryuukyoku {
+	var ryuukyoku Ryuukyoku
+	ryuukyoku.Type = ap.a.get("type")
+	if ba := ap.ints("ba"); len(ba) == 2 {
+		ryuukyoku.Honba, ryuukyoku.Riichi = ba[0], ba[1]
+	}
+	ryuukyoku.Scores, ryuukyoku.Deltas = ap.scoreDeltas("sc")
+	for i := 0; i < 4; i++ {
+		ryuukyoku.Hands[i] = ap.tiles("hai" + strconv.Itoa(i))
+	}
+	return &ryuukyoku
+}
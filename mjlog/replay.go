@@ -0,0 +1,278 @@
+package mjlog
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+type SeatDiscard struct {
+	Tile      Tile
+	Tsumogiri bool
+	Riichi    bool
+	Called    bool
+}
+
+type Seat struct {
+	Name         string
+	Hand         []Tile
+	Discards     []SeatDiscard
+	Melds        []Meld
+	Riichi       bool
+	RiichiTurn   int
+	Score        int
+	LastDraw     Tile
+	Disconnected bool
+
+	declaring bool
+}
+
+type State struct {
+	Type           GameType
+	Players        int
+	Round          int
+	Honba          int
+	Riichi         int
+	Oya            int
+	DoraIndicators []Tile
+	WallCount      int
+	Seats          [4]Seat
+	// LastEvent is the event most recently applied to the state.
+	LastEvent Event
+	Finished  bool
+}
+
+var roundWinds = []string{"East", "South", "West", "North"}
+
+func (s State) RoundName() string {
+	return fmt.Sprintf("%s %d", roundWinds[(s.Round/4)%4], s.Round%4+1)
+}
+
+func (s State) Clone() State {
+	c := s
+	c.DoraIndicators = append([]Tile(nil), s.DoraIndicators...)
+	for i := range s.Seats {
+		c.Seats[i].Hand = append([]Tile(nil), s.Seats[i].Hand...)
+		c.Seats[i].Discards = append([]SeatDiscard(nil), s.Seats[i].Discards...)
+		c.Seats[i].Melds = append([]Meld(nil), s.Seats[i].Melds...)
+	}
+	return c
+}
+
+func sortTiles(tiles []Tile) {
+	sort.Slice(tiles, func(i, j int) bool { return tiles[i] < tiles[j] })
+}
+
+func removeTile(hand []Tile, t Tile) ([]Tile, error) {
+	for i, h := range hand {
+		if h == t {
+			return append(hand[:i], hand[i+1:]...), nil
+		}
+	}
+	return hand, fmt.Errorf("Tile %s (%d) not in hand", t, int(t))
+}
+
+func (s *State) seat(who int) (*Seat, error) {
+	if who < 0 || who >= 4 {
+		return nil, fmt.Errorf("Invalid seat %d", who)
+	}
+	return &s.Seats[who], nil
+}
+
+func (s *State) Apply(ev Event) error {
+	s.LastEvent = ev
+	switch v := ev.(type) {
+	case *Go:
+		s.Type = v.Type
+		s.Players = v.Type.Players()
+	case *Un:
+		for i, name := range v.Names {
+			if name != "" {
+				s.Seats[i].Name = name
+				s.Seats[i].Disconnected = false
+			}
+		}
+	case *Taikyoku:
+		s.Oya = v.Oya
+	case *Init:
+		return s.applyInit(v)
+	case *Draw:
+		seat, err := s.seat(v.Who)
+		if err != nil {
+			return err
+		}
+		seat.Hand = append(seat.Hand, v.Tile)
+		seat.LastDraw = v.Tile
+		s.WallCount--
+	case *Discard:
+		return s.applyDiscard(v)
+	case *Call:
+		return s.applyCall(v)
+	case *Reach:
+		seat, err := s.seat(v.Who)
+		if err != nil {
+			return err
+		}
+		if v.Step == 1 {
+			seat.declaring = true
+			seat.RiichiTurn = len(seat.Discards)
+		} else if v.Step == 2 {
+			seat.Riichi = true
+			s.Riichi++
+			if v.Scores != [4]int{} {
+				for i := range s.Seats {
+					s.Seats[i].Score = v.Scores[i]
+				}
+			} else {
+				seat.Score -= 1000
+			}
+		}
+	case *Dora:
+		s.DoraIndicators = append(s.DoraIndicators, v.Tile)
+	case *Agari:
+		s.applyResult(v.Scores, v.Deltas)
+	case *Ryuukyoku:
+		s.applyResult(v.Scores, v.Deltas)
+	case *Bye:
+		seat, err := s.seat(v.Who)
+		if err != nil {
+			return err
+		}
+		seat.Disconnected = true
+	case *Owari:
+		for i := range s.Seats {
+			s.Seats[i].Score = v.Scores[i]
+		}
+		s.Finished = true
+	}
+	return nil
+}
+
+func (s *State) applyInit(v *Init) error {
+	if s.Players == 0 {
+		s.Players = 4
+		if len(v.Hands[3]) == 0 {
+			s.Players = 3
+		}
+	}
+	s.Round = v.Round
+	s.Honba = v.Honba
+	s.Riichi = v.Riichi
+	s.Oya = v.Oya
+	s.DoraIndicators = []Tile{v.DoraIndicator}
+	if s.Players == 3 {
+		s.WallCount = 108 - 14 - 3*13
+	} else {
+		s.WallCount = 136 - 14 - 4*13
+	}
+	for i := range s.Seats {
+		seat := &s.Seats[i]
+		seat.Hand = append([]Tile(nil), v.Hands[i]...)
+		sortTiles(seat.Hand)
+		seat.Discards = nil
+		seat.Melds = nil
+		seat.Riichi = false
+		seat.RiichiTurn = -1
+		seat.Score = v.Scores[i]
+		seat.LastDraw = -1
+		seat.declaring = false
+	}
+	return nil
+}
+
+func (s *State) applyDiscard(v *Discard) error {
+	seat, err := s.seat(v.Who)
+	if err != nil {
+		return err
+	}
+	seat.Hand, err = removeTile(seat.Hand, v.Tile)
+	if err != nil {
+		return fmt.Errorf("Discard by seat %d: %s", v.Who, err)
+	}
+	sortTiles(seat.Hand)
+	seat.Discards = append(seat.Discards, SeatDiscard{
+		Tile:      v.Tile,
+		Tsumogiri: v.Tile == seat.LastDraw,
+		Riichi:    seat.declaring,
+	})
+	seat.declaring = false
+	seat.LastDraw = -1
+	return nil
+}
+
+func (s *State) applyCall(v *Call) error {
+	seat, err := s.seat(v.Who)
+	if err != nil {
+		return err
+	}
+	m := v.Meld
+
+	switch m.Type {
+	case Chi, Pon, Daiminkan:
+		from := &s.Seats[m.FromWho]
+		if n := len(from.Discards); n > 0 {
+			from.Discards[n-1].Called = true
+		}
+		for _, t := range m.Tiles {
+			if t == m.Called {
+				continue
+			}
+			if seat.Hand, err = removeTile(seat.Hand, t); err != nil {
+				break
+			}
+		}
+		seat.Melds = append(seat.Melds, m)
+	case Kakan:
+		seat.Hand, err = removeTile(seat.Hand, m.Added)
+		for i, meld := range seat.Melds {
+			if meld.Type == Pon && meld.Called.Kind() == m.Called.Kind() {
+				seat.Melds[i] = m
+			}
+		}
+	case Ankan:
+		for _, t := range m.Tiles {
+			if seat.Hand, err = removeTile(seat.Hand, t); err != nil {
+				break
+			}
+		}
+		seat.Melds = append(seat.Melds, m)
+	case Nuki:
+		seat.Hand, err = removeTile(seat.Hand, m.Called)
+		seat.Melds = append(seat.Melds, m)
+	}
+	if err != nil {
+		return fmt.Errorf("%s by seat %d: %s", m.Type, v.Who, err)
+	}
+	seat.LastDraw = -1
+	return nil
+}
+
+func (s *State) applyResult(scores [4]int, deltas [4]int) {
+	for i := range s.Seats {
+		s.Seats[i].Score = scores[i] + deltas[i]
+	}
+	s.Riichi = 0
+}
+
+type Replay struct {
+	Parser
+	State State
+}
+
+func InitReplay(r io.Reader) (Replay, error) {
+	var rp Replay
+	var err error
+	rp.Parser, err = InitParser(r)
+	return rp, err
+}
+
+func (r *Replay) Scan() bool {
+	if !r.Parser.Scan() {
+		return false
+	}
+	if err := r.State.Apply(r.Token()); err != nil {
+		r.e = err
+		return false
+	}
+	return true
+}
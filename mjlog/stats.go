@@ -0,0 +1,293 @@
+package mjlog
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+type SeatSummary struct {
+	Rounds       int
+	Wins         int
+	DealIns      int
+	Riichi       int
+	Calls        int
+	WinPoints    int
+	DealInPoints int
+	Draws        int
+	DrawTenpai   int
+	Limits       [6]int
+	Yaku         map[int]*YakuStats
+}
+
+type YakuStats struct {
+	Count  int
+	Han    int
+	Points int
+}
+
+func (ys YakuStats) AverageHan() float64 {
+	return ratio(ys.Han, ys.Count)
+}
+
+func (ys YakuStats) AveragePoints() float64 {
+	return ratio(ys.Points, ys.Count)
+}
+
+func (ss *SeatSummary) addYaku(id int, han int, points int) {
+	if ss.Yaku == nil {
+		ss.Yaku = make(map[int]*YakuStats)
+	}
+	ys, ok := ss.Yaku[id]
+	if !ok {
+		ys = &YakuStats{}
+		ss.Yaku[id] = ys
+	}
+	ys.Count++
+	ys.Han += han
+	ys.Points += points
+}
+
+type GameSummary struct {
+	Type       GameType
+	Lobby      int
+	Players    int
+	Names      [4]string
+	Seats      [4]SeatSummary
+	Scores     [4]int
+	Placements [4]int
+}
+
+func placements(scores [4]int, players int) [4]int {
+	order := make([]int, players)
+	for i := range order {
+		order[i] = i
+	}
+	// Tenhou breaks ties in favour of the seat closest to the first dealer,
+	// which is always seat 0.
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	var ret [4]int
+	for place, seat := range order {
+		ret[seat] = place + 1
+	}
+	return ret
+}
+
+func SummarizeGame(r io.Reader) (GameSummary, error) {
+	var g GameSummary
+
+	p, err := InitParser(r)
+	if err != nil {
+		return g, err
+	}
+
+	var called, riichi, dealtIn [4]bool
+	finished := false
+	for p.Scan() {
+		switch v := p.Token().(type) {
+		case *Go:
+			g.Type = v.Type
+			g.Lobby = v.Lobby
+			g.Players = v.Type.Players()
+		case *Un:
+			if !v.Reconnect {
+				g.Names = v.Names
+			}
+		case *Init:
+			if g.Players == 0 {
+				g.Players = 4
+				if len(v.Hands[3]) == 0 {
+					g.Players = 3
+				}
+			}
+			called, riichi, dealtIn = [4]bool{}, [4]bool{}, [4]bool{}
+			for i := 0; i < g.Players; i++ {
+				g.Seats[i].Rounds++
+			}
+		case *Call:
+			if !called[v.Who] && (v.Meld.Type == Chi || v.Meld.Type == Pon || v.Meld.Type == Daiminkan) {
+				called[v.Who] = true
+				g.Seats[v.Who].Calls++
+			}
+		case *Reach:
+			if v.Step == 1 && !riichi[v.Who] {
+				riichi[v.Who] = true
+				g.Seats[v.Who].Riichi++
+			}
+		case *Agari:
+			g.Seats[v.Who].Wins++
+			g.Seats[v.Who].WinPoints += v.Points
+			if v.Limit >= NoLimit && v.Limit <= Yakuman {
+				g.Seats[v.Who].Limits[v.Limit]++
+			}
+			for _, y := range v.YakuList() {
+				g.Seats[v.Who].addYaku(y.ID, y.Han, v.Points)
+			}
+			if !v.Tsumo() {
+				if !dealtIn[v.FromWho] {
+					dealtIn[v.FromWho] = true
+					g.Seats[v.FromWho].DealIns++
+				}
+				g.Seats[v.FromWho].DealInPoints += v.Points
+			}
+		case *Ryuukyoku:
+			if v.Type != "" && v.Type != "nm" {
+				continue
+			}
+			for i := 0; i < g.Players; i++ {
+				g.Seats[i].Draws++
+				if v.Hands[i] != nil {
+					g.Seats[i].DrawTenpai++
+				}
+			}
+		case *Owari:
+			g.Scores = v.Scores
+			g.Placements = placements(v.Scores, g.Players)
+			finished = true
+		}
+	}
+	if err = p.Err(); err != nil {
+		return g, err
+	}
+	if !finished {
+		return g, errors.New("Game log is incomplete")
+	}
+	return g, nil
+}
+
+type PlayerStats struct {
+	Name       string
+	Games      int
+	Placements [4]int
+	SeatSummary
+}
+
+func (ps PlayerStats) AveragePlacement() float64 {
+	if ps.Games == 0 {
+		return 0
+	}
+	var sum int
+	for i, n := range ps.Placements {
+		sum += (i + 1) * n
+	}
+	return float64(sum) / float64(ps.Games)
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+func (ps PlayerStats) WinRate() float64 {
+	return ratio(ps.Wins, ps.Rounds)
+}
+
+func (ps PlayerStats) DealInRate() float64 {
+	return ratio(ps.DealIns, ps.Rounds)
+}
+
+func (ps PlayerStats) RiichiRate() float64 {
+	return ratio(ps.Riichi, ps.Rounds)
+}
+
+func (ps PlayerStats) CallRate() float64 {
+	return ratio(ps.Calls, ps.Rounds)
+}
+
+func (ps PlayerStats) AverageWin() float64 {
+	return ratio(ps.WinPoints, ps.Wins)
+}
+
+func (ps PlayerStats) AverageDealIn() float64 {
+	return ratio(ps.DealInPoints, ps.DealIns)
+}
+
+func (ps PlayerStats) DrawTenpaiRate() float64 {
+	return ratio(ps.DrawTenpai, ps.Draws)
+}
+
+func (ps PlayerStats) YakuRate(id int) float64 {
+	ys, ok := ps.Yaku[id]
+	if !ok {
+		return 0
+	}
+	return ratio(ys.Count, ps.Wins)
+}
+
+func (ps PlayerStats) LimitRate(l Limit) float64 {
+	return ratio(ps.Limits[l], ps.Wins)
+}
+
+// SortedYaku returns the IDs of all yaku the player won with, in yaku ID
+// order.
+func (ps PlayerStats) SortedYaku() []int {
+	ret := make([]int, 0, len(ps.Yaku))
+	for id := range ps.Yaku {
+		ret = append(ret, id)
+	}
+	sort.Ints(ret)
+	return ret
+}
+
+type Stats map[string]*PlayerStats
+
+// Add merges a game into the per-player totals. user maps a name from the log
+// to the name it should be counted under, and reports false for players who
+// should not be counted at all.
+func (s Stats) Add(g GameSummary, user func(string) (string, bool)) {
+	for i := 0; i < g.Players; i++ {
+		name, ok := user(g.Names[i])
+		if !ok {
+			continue
+		}
+		ps, ok := s[name]
+		if !ok {
+			ps = &PlayerStats{Name: name}
+			s[name] = ps
+		}
+		ps.Games++
+		if place := g.Placements[i]; place > 0 {
+			ps.Placements[place-1]++
+		}
+		seat := g.Seats[i]
+		ps.Rounds += seat.Rounds
+		ps.Wins += seat.Wins
+		ps.DealIns += seat.DealIns
+		ps.Riichi += seat.Riichi
+		ps.Calls += seat.Calls
+		ps.WinPoints += seat.WinPoints
+		ps.DealInPoints += seat.DealInPoints
+		ps.Draws += seat.Draws
+		ps.DrawTenpai += seat.DrawTenpai
+		for i, n := range seat.Limits {
+			ps.Limits[i] += n
+		}
+		for id, ys := range seat.Yaku {
+			if ps.Yaku == nil {
+				ps.Yaku = make(map[int]*YakuStats)
+			}
+			total, ok := ps.Yaku[id]
+			if !ok {
+				total = &YakuStats{}
+				ps.Yaku[id] = total
+			}
+			total.Count += ys.Count
+			total.Han += ys.Han
+			total.Points += ys.Points
+		}
+	}
+}
+
+func (s Stats) Sorted() []*PlayerStats {
+	ret := make([]*PlayerStats, 0, len(s))
+	for _, ps := range s {
+		ret = append(ret, ps)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
@@ -0,0 +1,58 @@
+package mjlog
+
+import (
+	"os"
+	"testing"
+)
+
+func openTestLog(t *testing.T, name string) *os.File {
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestPlacements(t *testing.T) {
+	tests := []struct {
+		scores     [4]int
+		players    int
+		placements [4]int
+	}{
+		{[4]int{25000, 35000, 30000, 10000}, 4, [4]int{3, 1, 2, 4}},
+		{[4]int{20000, 30000, 30000, 20000}, 4, [4]int{3, 1, 2, 4}},
+		{[4]int{25000, 25000, 25000, 25000}, 4, [4]int{1, 2, 3, 4}},
+		{[4]int{35000, 35000, 35000, 0}, 3, [4]int{1, 2, 3, 0}},
+	}
+	for _, test := range tests {
+		if p := placements(test.scores, test.players); p != test.placements {
+			t.Errorf("placements(%v, %d) = %v, want %v", test.scores, test.players, p, test.placements)
+		}
+	}
+}
+
+func TestSummarizeGame(t *testing.T) {
+	file := openTestLog(t, "riichi.xml")
+	defer file.Close()
+
+	g, err := SummarizeGame(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Players != 4 || g.Names != [4]string{"A", "B", "C", "D"} {
+		t.Errorf("Got %d players %v, want 4 players [A B C D]", g.Players, g.Names)
+	}
+	if want := [4]int{24000, 28000, 24000, 24000}; g.Scores != want {
+		t.Errorf("Scores = %v, want %v", g.Scores, want)
+	}
+	// seats 0, 2 and 3 tie and are placed in seat order
+	if want := [4]int{2, 1, 3, 4}; g.Placements != want {
+		t.Errorf("Placements = %v, want %v", g.Placements, want)
+	}
+	if g.Seats[1].Wins != 1 || g.Seats[1].WinPoints != 1000 {
+		t.Errorf("Seat 1 won %d times for %d, want 1 for 1000", g.Seats[1].Wins, g.Seats[1].WinPoints)
+	}
+	if g.Seats[0].DealIns != 1 || g.Seats[2].Riichi != 1 || g.Seats[3].Riichi != 1 {
+		t.Errorf("Got deal ins %d and riichi %d, %d, want 1, 1, 1", g.Seats[0].DealIns, g.Seats[2].Riichi, g.Seats[3].Riichi)
+	}
+}
@@ -0,0 +1,312 @@
+package mjlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type Tenhou6Rule struct {
+	Disp  string `json:"disp"`
+	Aka   int    `json:"aka"`
+	Aka51 int    `json:"aka51"`
+	Aka52 int    `json:"aka52"`
+	Aka53 int    `json:"aka53"`
+}
+
+// Tenhou6 is a game in the JSON format used by the tenhou.net/6 viewer.
+type Tenhou6 struct {
+	Title []string        `json:"title"`
+	Name  []string        `json:"name"`
+	Rule  Tenhou6Rule     `json:"rule"`
+	Log   [][]interface{} `json:"log"`
+	Sc    []float64       `json:"sc,omitempty"`
+	Ref   string          `json:"ref,omitempty"`
+}
+
+const tenhou6Tsumogiri = 60
+
+func tenhou6Tile(t Tile, red bool) int {
+	if red && t.IsRed() {
+		return 51 + t.Suit()
+	}
+	return (t.Suit()+1)*10 + t.Number()
+}
+
+type tenhou6Round struct {
+	info     []int
+	scores   []int
+	dora     []int
+	ura      []int
+	haipai   [4][]int
+	takes    [4][]interface{}
+	discards [4][]interface{}
+	result   []interface{}
+}
+
+func (r *tenhou6Round) entry() []interface{} {
+	ret := []interface{}{r.info, r.scores, r.dora, r.ura}
+	for i := 0; i < 4; i++ {
+		ret = append(ret, r.haipai[i], r.takes[i], r.discards[i])
+	}
+	return append(ret, r.result)
+}
+
+type tenhou6Converter struct {
+	game       Tenhou6
+	red        bool
+	players    int
+	oya        int
+	honba      int
+	round      *tenhou6Round
+	lastDraw   [4]Tile
+	riichiNext [4]bool
+}
+
+func (c *tenhou6Converter) tile(t Tile) int {
+	return tenhou6Tile(t, c.red)
+}
+
+func (c *tenhou6Converter) tiles(tiles []Tile) []int {
+	ret := make([]int, 0, len(tiles))
+	for _, t := range tiles {
+		ret = append(ret, c.tile(t))
+	}
+	return ret
+}
+
+func (c *tenhou6Converter) meldString(m Meld) string {
+	var others []int
+	for _, t := range m.Tiles {
+		if t != m.Called && t != m.Added {
+			others = append(others, c.tile(t))
+		}
+	}
+	str := func(ts ...int) string {
+		var s string
+		for _, t := range ts {
+			s += strconv.Itoa(t)
+		}
+		return s
+	}
+	called := strconv.Itoa(c.tile(m.Called))
+	rel := (m.FromWho - m.Who + 4) % 4
+
+	switch m.Type {
+	case Chi:
+		return "c" + called + str(others...)
+	case Pon:
+		switch rel {
+		case 3:
+			return "p" + called + str(others...)
+		case 2:
+			return str(others[0]) + "p" + called + str(others[1])
+		default:
+			return str(others...) + "p" + called
+		}
+	case Daiminkan:
+		switch rel {
+		case 3:
+			return "m" + called + str(others...)
+		case 2:
+			return str(others[0]) + "m" + called + str(others[1:]...)
+		default:
+			return str(others...) + "m" + called
+		}
+	case Kakan:
+		added := "k" + strconv.Itoa(c.tile(m.Added)) + called
+		switch rel {
+		case 3:
+			return added + str(others...)
+		case 2:
+			return str(others[0]) + added + str(others[1])
+		default:
+			return str(others...) + added
+		}
+	case Ankan:
+		all := c.tiles(m.Tiles)
+		return str(all[:3]...) + "a" + str(all[3])
+	case Nuki:
+		return "f" + called
+	}
+	return ""
+}
+
+func (c *tenhou6Converter) agariInfo(a *Agari) []interface{} {
+	pao := a.Who
+	if a.PaoWho != -1 {
+		pao = a.PaoWho
+	}
+
+	var value string
+	if a.Limit != NoLimit {
+		value = a.Limit.Kanji()
+	} else {
+		value = fmt.Sprintf("%d符%d飜", a.Fu, a.Han())
+	}
+	switch {
+	case !a.Tsumo():
+		value += fmt.Sprintf("%d点", a.Points)
+	case a.Who == c.oya:
+		loser := (a.Who + 1) % c.players
+		value += fmt.Sprintf("%d点∀", -a.Deltas[loser]-c.honba*100)
+	default:
+		ko := -1
+		for i := 0; i < c.players; i++ {
+			if i != a.Who && i != c.oya {
+				ko = i
+				break
+			}
+		}
+		value += fmt.Sprintf("%d-%d点", -a.Deltas[ko]-c.honba*100, -a.Deltas[c.oya]-c.honba*100)
+	}
+
+	info := []interface{}{a.Who, a.FromWho, pao, value}
+	for _, y := range a.YakuList() {
+		if y.Yakuman {
+			info = append(info, YakuKanji(y.ID)+"(役満)")
+		} else {
+			info = append(info, fmt.Sprintf("%s(%d飜)", YakuKanji(y.ID), y.Han))
+		}
+	}
+	return info
+}
+
+var ryuukyokuNames = map[string]string{
+	"":       "流局",
+	"yao9":   "九種九牌",
+	"reach4": "四家立直",
+	"ron3":   "三家和了",
+	"kan4":   "四槓散了",
+	"kaze4":  "四風連打",
+	"nm":     "流し満貫",
+}
+
+func (c *tenhou6Converter) endRound() {
+	if c.round != nil {
+		c.game.Log = append(c.game.Log, c.round.entry())
+		c.round = nil
+	}
+}
+
+func (c *tenhou6Converter) apply(ev Event) error {
+	switch ev.(type) {
+	case *Draw, *Discard, *Call, *Dora, *Agari, *Ryuukyoku:
+		if c.round == nil {
+			return fmt.Errorf("%s outside of a round", ev.Tag())
+		}
+	}
+
+	switch v := ev.(type) {
+	case *Go:
+		c.red = v.Type.Red()
+		c.players = v.Type.Players()
+		c.game.Rule = Tenhou6Rule{Disp: v.Type.String()}
+		if c.red {
+			c.game.Rule.Aka, c.game.Rule.Aka51, c.game.Rule.Aka52, c.game.Rule.Aka53 = 1, 1, 1, 1
+		}
+	case *Un:
+		if !v.Reconnect {
+			c.game.Name = v.Names[:]
+		}
+	case *Init:
+		c.endRound()
+		c.oya = v.Oya
+		c.honba = v.Honba
+		c.round = &tenhou6Round{
+			info:   []int{v.Round, v.Honba, v.Riichi},
+			scores: v.Scores[:],
+			dora:   []int{c.tile(v.DoraIndicator)},
+			ura:    []int{},
+		}
+		for i := 0; i < 4; i++ {
+			c.round.haipai[i] = c.tiles(v.Hands[i])
+			c.round.takes[i] = []interface{}{}
+			c.round.discards[i] = []interface{}{}
+			c.lastDraw[i] = -1
+			c.riichiNext[i] = false
+		}
+	case *Draw:
+		c.round.takes[v.Who] = append(c.round.takes[v.Who], c.tile(v.Tile))
+		c.lastDraw[v.Who] = v.Tile
+	case *Discard:
+		var d interface{} = c.tile(v.Tile)
+		if v.Tile == c.lastDraw[v.Who] {
+			d = tenhou6Tsumogiri
+		}
+		if c.riichiNext[v.Who] {
+			d = fmt.Sprintf("r%d", d)
+			c.riichiNext[v.Who] = false
+		}
+		c.round.discards[v.Who] = append(c.round.discards[v.Who], d)
+		c.lastDraw[v.Who] = -1
+	case *Call:
+		s := c.meldString(v.Meld)
+		switch v.Meld.Type {
+		case Chi, Pon:
+			c.round.takes[v.Who] = append(c.round.takes[v.Who], s)
+		case Daiminkan:
+			c.round.takes[v.Who] = append(c.round.takes[v.Who], s)
+			c.round.discards[v.Who] = append(c.round.discards[v.Who], 0)
+		default:
+			c.round.discards[v.Who] = append(c.round.discards[v.Who], s)
+		}
+		c.lastDraw[v.Who] = -1
+	case *Reach:
+		if v.Step == 1 {
+			c.riichiNext[v.Who] = true
+		}
+	case *Dora:
+		c.round.dora = append(c.round.dora, c.tile(v.Tile))
+	case *Agari:
+		if len(c.round.result) == 0 {
+			c.round.result = []interface{}{"和了"}
+		}
+		if len(c.round.ura) == 0 && len(v.UraIndicators) > 0 {
+			c.round.ura = c.tiles(v.UraIndicators)
+		}
+		c.round.result = append(c.round.result, v.Deltas[:], c.agariInfo(v))
+	case *Ryuukyoku:
+		name, ok := ryuukyokuNames[v.Type]
+		if !ok {
+			name = v.Type
+		}
+		c.round.result = []interface{}{name}
+		if v.Type == "" || v.Type == "nm" {
+			c.round.result = append(c.round.result, v.Deltas[:])
+		}
+	case *Owari:
+		c.endRound()
+		c.game.Sc = nil
+		for i := 0; i < 4; i++ {
+			c.game.Sc = append(c.game.Sc, float64(v.Scores[i]), v.Points[i])
+		}
+	}
+	return nil
+}
+
+// ConvertTenhou6 reads an mjlog and converts it to the tenhou.net/6 format.
+func ConvertTenhou6(r io.Reader) (Tenhou6, error) {
+	c := tenhou6Converter{players: 4}
+	c.game.Title = []string{"", ""}
+	c.game.Name = []string{"", "", "", ""}
+
+	p, err := InitParser(r)
+	if err != nil {
+		return c.game, err
+	}
+	for p.Scan() {
+		if err = c.apply(p.Token()); err != nil {
+			return c.game, err
+		}
+	}
+	if err = p.Err(); err != nil {
+		return c.game, err
+	}
+	c.endRound()
+	if len(c.game.Log) == 0 {
+		return c.game, errors.New("Game log contains no rounds")
+	}
+	return c.game, nil
+}
@@ -0,0 +1,31 @@
+package mjlog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertTenhou6Discards(t *testing.T) {
+	file := openTestLog(t, "riichi.xml")
+	defer file.Close()
+
+	game, err := ConvertTenhou6(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(game.Log) != 1 {
+		t.Fatalf("Got %d rounds, want 1", len(game.Log))
+	}
+	// tsumogiri discards are 60 and riichi discards are prefixed with r
+	want := [4][]interface{}{
+		{60, 11},
+		{11},
+		{"r60"},
+		{"r11"},
+	}
+	for i := 0; i < 4; i++ {
+		if discards := game.Log[0][6+3*i]; !reflect.DeepEqual(discards, want[i]) {
+			t.Errorf("Discards of seat %d = %v, want %v", i, discards, want[i])
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package mjlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Tile int
+
+const (
+	Man   = 0
+	Pin   = 1
+	Sou   = 2
+	Honor = 3
+)
+
+func (t Tile) Kind() int {
+	return int(t) / 4
+}
+
+func (t Tile) Suit() int {
+	return t.Kind() / 9
+}
+
+func (t Tile) Number() int {
+	return t.Kind()%9 + 1
+}
+
+func (t Tile) IsRed() bool {
+	return t == 16 || t == 52 || t == 88
+}
+
+func (t Tile) String() string {
+	if t < 0 || t > 135 {
+		return fmt.Sprintf("?%d", int(t))
+	}
+	return strconv.Itoa(t.Number()) + string("mpsz"[t.Suit()])
+}
+
+func parseTiles(s string) ([]Tile, error) {
+	if s == "" {
+		return nil, nil
+	}
+	fields := strings.Split(s, ",")
+	tiles := make([]Tile, len(fields))
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n > 135 {
+			return nil, fmt.Errorf("Tile %d out of range", n)
+		}
+		tiles[i] = Tile(n)
+	}
+	return tiles, nil
+}
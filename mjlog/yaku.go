@@ -0,0 +1,131 @@
+package mjlog
+
+import (
+	"strconv"
+)
+
+var yakuNames = []string{
+	"Menzen Tsumo", "Riichi", "Ippatsu", "Chankan", "Rinshan Kaihou",
+	"Haitei Raoyue", "Houtei Raoyui", "Pinfu", "Tanyao", "Iipeikou",
+	"Jikaze Ton", "Jikaze Nan", "Jikaze Sha", "Jikaze Pei",
+	"Bakaze Ton", "Bakaze Nan", "Bakaze Sha", "Bakaze Pei",
+	"Yakuhai Haku", "Yakuhai Hatsu", "Yakuhai Chun",
+	"Double Riichi", "Chiitoitsu", "Chanta", "Ittsu",
+	"Sanshoku Doujun", "Sanshoku Doukou", "Sankantsu", "Toitoi", "Sanankou",
+	"Shousangen", "Honroutou", "Ryanpeikou", "Junchan", "Honitsu", "Chinitsu",
+	"Renhou", "Tenhou", "Chiihou", "Daisangen", "Suuankou", "Suuankou Tanki",
+	"Tsuuiisou", "Ryuuiisou", "Chinroutou", "Chuuren Poutou",
+	"Junsei Chuuren Poutou", "Kokushi Musou", "Kokushi Musou Juusanmen",
+	"Daisuushii", "Shousuushii", "Suukantsu", "Dora", "Ura Dora", "Aka Dora",
+}
+
+var yakuKanji = []string{
+	"門前清自摸和", "立直", "一発", "槍槓", "嶺上開花",
+	"海底摸月", "河底撈魚", "平和", "断幺九", "一盃口",
+	"自風 東", "自風 南", "自風 西", "自風 北",
+	"場風 東", "場風 南", "場風 西", "場風 北",
+	"役牌 白", "役牌 發", "役牌 中",
+	"両立直", "七対子", "混全帯幺九", "一気通貫",
+	"三色同順", "三色同刻", "三槓子", "対々和", "三暗刻",
+	"小三元", "混老頭", "二盃口", "純全帯幺九", "混一色", "清一色",
+	"人和", "天和", "地和", "大三元", "四暗刻", "四暗刻単騎",
+	"字一色", "緑一色", "清老頭", "九蓮宝燈",
+	"純正九蓮宝燈", "国士無双", "国士無双１３面",
+	"大四喜", "小四喜", "四槓子", "ドラ", "裏ドラ", "赤ドラ",
+}
+
+func YakuKanji(id int) string {
+	if id < 0 || id >= len(yakuKanji) {
+		return "役" + strconv.Itoa(id)
+	}
+	return yakuKanji[id]
+}
+
+func YakuName(id int) string {
+	if id < 0 || id >= len(yakuNames) {
+		return "Unknown Yaku " + strconv.Itoa(id)
+	}
+	return yakuNames[id]
+}
+
+func IsDora(id int) bool {
+	return id >= 52 && id <= 54
+}
+
+type Yaku struct {
+	ID      int
+	Name    string
+	Han     int
+	Yakuman bool
+}
+
+type Limit int
+
+const (
+	NoLimit Limit = iota
+	Mangan
+	Haneman
+	Baiman
+	Sanbaiman
+	Yakuman
+)
+
+func (l Limit) String() string {
+	switch l {
+	case NoLimit:
+		return ""
+	case Mangan:
+		return "Mangan"
+	case Haneman:
+		return "Haneman"
+	case Baiman:
+		return "Baiman"
+	case Sanbaiman:
+		return "Sanbaiman"
+	case Yakuman:
+		return "Yakuman"
+	default:
+		return "Unknown Limit " + strconv.Itoa(int(l))
+	}
+}
+
+func (l Limit) Kanji() string {
+	switch l {
+	case Mangan:
+		return "満貫"
+	case Haneman:
+		return "跳満"
+	case Baiman:
+		return "倍満"
+	case Sanbaiman:
+		return "三倍満"
+	case Yakuman:
+		return "役満"
+	default:
+		return ""
+	}
+}
+
+// YakuList returns the named yaku of the hand, yakuman counting 13 han each.
+// Dora entries without any dora are left out.
+func (a Agari) YakuList() []Yaku {
+	var ret []Yaku
+	for _, y := range a.Yaku {
+		if IsDora(y.ID) && y.Han == 0 {
+			continue
+		}
+		ret = append(ret, Yaku{ID: y.ID, Name: YakuName(y.ID), Han: y.Han})
+	}
+	for _, id := range a.Yakuman {
+		ret = append(ret, Yaku{ID: id, Name: YakuName(id), Han: 13, Yakuman: true})
+	}
+	return ret
+}
+
+func (a Agari) Han() int {
+	var han int
+	for _, y := range a.YakuList() {
+		han += y.Han
+	}
+	return han
+}
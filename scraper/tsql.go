@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 
 	s "github.com/c-14/gtenlog/storage"
+	"github.com/c-14/gtenlog/tenhou"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -89,6 +91,11 @@ func WriteLogs(path string, logs chan s.TenhouLocalStorage, errChan chan error,
 	}()
 
 	for logItem := range logs {
+		if _, err := tenhou.ParseLogID(logItem.Log); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", logItem.Log, err)
+			continue
+		}
+
 		logData, err := readUserLog(&userLogs, path, logItem.Users[0])
 		if err != nil {
 			errChan <- err
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AggregationRecord describes how a daily log was built from hourly parts,
+// so that it can be checked again after the parts are gone.
+type AggregationRecord struct {
+	// File is the daily log relative to the archive root
+	File  string   `json:"file"`
+	Parts []string `json:"parts"`
+	// PartLines is the number of lines in all parts, including duplicates
+	PartLines int `json:"partLines"`
+	Lines     int `json:"lines"`
+	// SHA256 is the hash of the decompressed daily log
+	SHA256 string    `json:"sha256"`
+	Time   time.Time `json:"time"`
+}
+
+func (a LogArchive) aggregationPath() string {
+	return filepath.Join(a.PathRoot, "aggregations.index")
+}
+
+func (a LogArchive) ReadAggregationRecords() (map[string]AggregationRecord, error) {
+	records := make(map[string]AggregationRecord)
+
+	file, err := os.Open(a.aggregationPath())
+	if os.IsNotExist(err) {
+		return records, nil
+	} else if err != nil {
+		return records, err
+	}
+	defer file.Close()
+
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var rec AggregationRecord
+		err = json.Unmarshal(lines.Bytes(), &rec)
+		if err != nil {
+			return records, err
+		}
+		records[rec.File] = rec
+	}
+	return records, lines.Err()
+}
+
+func (a LogArchive) addAggregationRecord(rec AggregationRecord) error {
+	records, err := a.ReadAggregationRecords()
+	if err != nil {
+		return err
+	}
+	records[rec.File] = rec
+
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	file, err := createAtomic(a.aggregationPath())
+	if err != nil {
+		return err
+	}
+
+	wrLines := bufio.NewWriter(file)
+	enc := json.NewEncoder(wrLines)
+	for _, k := range keys {
+		if err = enc.Encode(records[k]); err != nil {
+			file.Abort()
+			return err
+		}
+	}
+	if err = wrLines.Flush(); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
+
+// CheckAggregation verifies that a daily log still matches the record
+// written when it was aggregated.
+func (a LogArchive) CheckAggregation(rec AggregationRecord) error {
+	lines, sum, err := readLogLines(filepath.Join(a.PathRoot, rec.File))
+	if err != nil {
+		return err
+	}
+	if len(lines) != rec.Lines {
+		return fmt.Errorf("%s has %d lines, expected %d", rec.File, len(lines), rec.Lines)
+	}
+	if sum != rec.SHA256 {
+		return fmt.Errorf("%s has changed since it was aggregated", rec.File)
+	}
+	return nil
+}
+
+// readLogLines decompresses a gzip log and returns its lines along with the
+// SHA256 of its decompressed content. Lines keep their line endings.
+func readLogLines(path string) ([]string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	return readGzipLines(file, path)
+}
+
+func readGzipLines(r io.Reader, path string) ([]string, string, error) {
+	gzLog, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("Corrupt gzip input file: %v (%v)", path, err)
+	}
+	defer gzLog.Close()
+
+	hash := sha256.New()
+	var lines []string
+	rdLog := bufio.NewReader(io.TeeReader(gzLog, hash))
+	for {
+		line, err := rdLog.ReadString('\n')
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, "", fmt.Errorf("Could not read from gzip input file: %v (%v)", path, err)
+		}
+	}
+	return lines, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// lineContent strips the line ending, which may be \r\n in some logs.
+func lineContent(line string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -16,14 +18,14 @@ type LogArchive struct {
 type SCRAWLogInfo struct {
 	statInfo  os.FileInfo
 	existsErr error
-	file      *os.File
+	file      pendingFile
 	path      string
 }
 
 type SCxLogInfo struct {
 	statInfo  os.FileInfo
 	existsErr error
-	file      *os.File
+	file      pendingFile
 	path      string
 }
 
@@ -33,8 +35,21 @@ type LogInfo interface {
 
 	Open() error
 	Close() error
+	Abort() error
 	Write([]byte) (int, error)
 	Remove() error
+
+	Partial() (PartialDownload, bool, error)
+	OpenPartial(PartialDownload, int64) error
+	RemovePartial() error
+}
+
+// pendingFile is an archive file being written, which only appears at its
+// final path once committed.
+type pendingFile interface {
+	io.Writer
+	Commit() error
+	Abort() error
 }
 
 func (a LogArchive) GetUserLogNames(user string, logs chan UserLogInfo, errChan chan error) {
@@ -96,7 +111,11 @@ func (l SCxLogInfo) Remove() error {
 }
 
 func (l *SCxLogInfo) Close() error {
-	return l.file.Close()
+	return l.file.Commit()
+}
+
+func (l *SCxLogInfo) Abort() error {
+	return l.file.Abort()
 }
 
 func (l *SCxLogInfo) Write(p []byte) (int, error) {
@@ -108,6 +127,19 @@ func (l *SCxLogInfo) Open() (err error) {
 	return
 }
 
+func (l SCxLogInfo) Partial() (PartialDownload, bool, error) {
+	return readPartial(l.path)
+}
+
+func (l *SCxLogInfo) OpenPartial(p PartialDownload, offset int64) (err error) {
+	l.file, err = openPartial(l.path, p, offset)
+	return
+}
+
+func (l SCxLogInfo) RemovePartial() error {
+	return removePartial(l.path)
+}
+
 func (a LogArchive) AddSCxLogInfo(scx string, date time.Time, fName string) SCxLogInfo {
 	var log SCxLogInfo
 
@@ -142,7 +174,11 @@ func (l SCRAWLogInfo) Remove() error {
 }
 
 func (l *SCRAWLogInfo) Close() error {
-	return l.file.Close()
+	return l.file.Commit()
+}
+
+func (l *SCRAWLogInfo) Abort() error {
+	return l.file.Abort()
 }
 
 func (l *SCRAWLogInfo) Write(p []byte) (int, error) {
@@ -154,6 +190,19 @@ func (l *SCRAWLogInfo) Open() (err error) {
 	return
 }
 
+func (l SCRAWLogInfo) Partial() (PartialDownload, bool, error) {
+	return readPartial(l.path)
+}
+
+func (l *SCRAWLogInfo) OpenPartial(p PartialDownload, offset int64) (err error) {
+	l.file, err = openPartial(l.path, p, offset)
+	return
+}
+
+func (l SCRAWLogInfo) RemovePartial() error {
+	return removePartial(l.path)
+}
+
 func (a LogArchive) AddSCRAWLogInfo(year int) SCRAWLogInfo {
 	var log SCRAWLogInfo
 
@@ -162,3 +211,42 @@ func (a LogArchive) AddSCRAWLogInfo(year int) SCRAWLogInfo {
 
 	return log
 }
+
+// MissingSCxDays returns the days between start and end for which no daily
+// or hourly log of any type is in the archive.
+func (a LogArchive) MissingSCxDays(start, end time.Time) ([]time.Time, error) {
+	present := make(map[string]bool)
+	for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location()); !month.After(end); month = month.AddDate(0, 1, 0) {
+		for _, scx := range []string{"sca", "scb", "scc", "scd", "sce"} {
+			names, err := readDirNames(filepath.Join(a.PathRoot, scx, month.Format("2006"), month.Format("01")))
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				if len(name) < 11 || name[:3] != scx || strings.HasSuffix(name, partialSuffix) || strings.HasSuffix(name, partialSuffix+".json") {
+					continue
+				}
+				present[name[3:11]] = true
+			}
+		}
+	}
+
+	var missing []time.Time
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if !present[day.Format("20060102")] {
+			missing = append(missing, day)
+		}
+	}
+	return missing, nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	d, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return d.Readdirnames(-1)
+}
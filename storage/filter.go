@@ -0,0 +1,658 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// LineFilter selects the SCx log lines GrepLogs outputs.
+type LineFilter interface {
+	MatchLine(line SCxLogLine, aliases UserListing) bool
+}
+
+// lineFields are the columns shared by every SCx log line type. scb logs
+// are all from the ranked lobby L0000, scc logs have no lobby.
+type lineFields struct {
+	Lobby string
+	Start time.Time
+	Mode  GameMode
+	Score []UserScore
+}
+
+func fieldsOf(line SCxLogLine) lineFields {
+	switch v := line.(type) {
+	case *SCALogLine:
+		return lineFields{v.Lobby, v.StartTime, v.GameMode, v.Score}
+	case *SCBLogLine:
+		return lineFields{"L0000", v.StartTime, v.GameMode, v.Score}
+	case *SCCLogLine:
+		return lineFields{"", v.StartTime, v.GameMode, v.Score}
+	case *SCDLogLine:
+		return lineFields{v.Lobby, v.StartTime, v.GameMode, v.Score}
+	case *SCELogLine:
+		return lineFields{v.Lobby, v.StartTime, v.GameMode, v.Score}
+	}
+	return lineFields{}
+}
+
+type allFilters []LineFilter
+
+// AllFilters matches lines that every one of filters matches.
+func AllFilters(filters ...LineFilter) LineFilter {
+	return allFilters(filters)
+}
+
+func (f allFilters) MatchLine(line SCxLogLine, aliases UserListing) bool {
+	for _, filter := range f {
+		if filter != nil && !filter.MatchLine(line, aliases) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f GameModeFilter) MatchLine(line SCxLogLine, aliases UserListing) bool {
+	return f.Match(fieldsOf(line).Mode)
+}
+
+// isPlayer reports whether score belongs to name, which is either a player
+// name or a user from the users file.
+func isPlayer(score UserScore, name string, aliases UserListing) bool {
+	if score.UserName == name {
+		return true
+	}
+	user, _ := aliases.User(score.UserName)
+	return user == name
+}
+
+type matcher func(f lineFields, aliases UserListing) bool
+
+type exprFilter struct {
+	match matcher
+}
+
+func (e exprFilter) MatchLine(line SCxLogLine, aliases UserListing) bool {
+	return e.match(fieldsOf(line), aliases)
+}
+
+// ParseFilter parses a grep filter expression. Conditions are combined with
+// and, or, not and parentheses, and compare a field with =, !=, <, <=, >,
+// >=, in or has:
+//
+//	lobby in (L1234,L5678)        lobby in L1000..L1999
+//	mode = 四鳳南喰赤             mode.players = 3
+//	mode.tier = houou             mode.length = hanchan
+//	mode.kuitan = true            mode.red, mode.fast likewise
+//	players has alice             players has all(alice,bob)
+//	players has any(alice,bob)    time in 22:00..02:00
+//	score > 30                    score(alice) >= 0
+//	placement(alice) = 1          chips(bob) < 0
+//
+// Player names also match the alias groups from the users file. Without a
+// player, score, placement and chips match if any player at the table does.
+func ParseFilter(expr string) (LineFilter, error) {
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := filterParser{toks: toks}
+	m, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return exprFilter{m}, nil
+}
+
+const (
+	tokEOF = iota
+	tokWord
+	tokString
+	tokLParen
+	tokRParen
+	tokComma
+	tokOp
+)
+
+type filterToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`(),=!<>"`, r)
+}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var toks []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, filterToken{tokLParen, "(", i})
+			i++
+		case r == ')':
+			toks = append(toks, filterToken{tokRParen, ")", i})
+			i++
+		case r == ',':
+			toks = append(toks, filterToken{tokComma, ",", i})
+			i++
+		case r == '=':
+			toks = append(toks, filterToken{tokOp, "=", i})
+			i++
+		case r == '!' || r == '<' || r == '>':
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			} else if r == '!' {
+				return nil, fmt.Errorf("Invalid filter at %d: expected !=", i)
+			}
+			toks = append(toks, filterToken{tokOp, op, i})
+			i += len(op)
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("Invalid filter at %d: unterminated string", i)
+			}
+			toks = append(toks, filterToken{tokString, string(runes[i+1 : end]), i})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			kind := tokWord
+			if lower := strings.ToLower(word); lower == "in" || lower == "has" {
+				kind, word = tokOp, lower
+			}
+			toks = append(toks, filterToken{kind, word, i})
+			i = end
+		}
+	}
+	return append(toks, filterToken{tokEOF, "end of filter", len(runes)}), nil
+}
+
+type filterParser struct {
+	toks []filterToken
+	i    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.toks[p.i]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.toks[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *filterParser) keyword(kw string) bool {
+	if tok := p.peek(); tok.kind == tokWord && strings.EqualFold(tok.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(kind int, text string) error {
+	if tok := p.next(); tok.kind != kind {
+		return p.errorf(tok, "expected %s, got %q", text, tok.text)
+	}
+	return nil
+}
+
+func (p *filterParser) errorf(tok filterToken, format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid filter at %d: %s", tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) parseOr() (matcher, error) {
+	m, err := p.parseAnd()
+	for err == nil && p.keyword("or") {
+		var r matcher
+		if r, err = p.parseAnd(); err == nil {
+			l := m
+			m = func(f lineFields, aliases UserListing) bool { return l(f, aliases) || r(f, aliases) }
+		}
+	}
+	return m, err
+}
+
+func (p *filterParser) parseAnd() (matcher, error) {
+	m, err := p.parseNot()
+	for err == nil && p.keyword("and") {
+		var r matcher
+		if r, err = p.parseNot(); err == nil {
+			l := m
+			m = func(f lineFields, aliases UserListing) bool { return l(f, aliases) && r(f, aliases) }
+		}
+	}
+	return m, err
+}
+
+func (p *filterParser) parseNot() (matcher, error) {
+	if p.keyword("not") {
+		m, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(f lineFields, aliases UserListing) bool { return !m(f, aliases) }, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		m, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return m, p.expect(tokRParen, ")")
+	}
+	return p.parseCondition()
+}
+
+func (p *filterParser) parseValue() (filterToken, error) {
+	tok := p.next()
+	if tok.kind != tokWord && tok.kind != tokString {
+		return tok, p.errorf(tok, "expected a value, got %q", tok.text)
+	}
+	return tok, nil
+}
+
+func (p *filterParser) parseList() ([]filterToken, error) {
+	if err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	var values []filterToken
+	for {
+		tok, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, tok)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	return values, p.expect(tokRParen, ")")
+}
+
+// filterValues are the right hand side of a condition: a single value, a
+// list for in, or an inclusive range lo..hi for in.
+type filterValues struct {
+	op      string
+	values  []filterToken
+	lo, hi  filterToken
+	isRange bool
+}
+
+func (p *filterParser) parseValues(op filterToken) (filterValues, error) {
+	v := filterValues{op: op.text}
+	switch {
+	case op.text == "in" && p.peek().kind == tokLParen:
+		list, err := p.parseList()
+		v.values = list
+		return v, err
+	case op.text == "in":
+		tok, err := p.parseValue()
+		if err != nil {
+			return v, err
+		}
+		bounds := strings.SplitN(tok.text, "..", 2)
+		if len(bounds) != 2 {
+			return v, p.errorf(tok, "expected a list (a,b) or a range a..b after in")
+		}
+		v.isRange = true
+		v.lo = filterToken{tok.kind, bounds[0], tok.pos}
+		v.hi = filterToken{tok.kind, bounds[1], tok.pos}
+		return v, nil
+	default:
+		tok, err := p.parseValue()
+		v.values = []filterToken{tok}
+		return v, err
+	}
+}
+
+func (p *filterParser) parseCondition() (matcher, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokWord {
+		return nil, p.errorf(fieldTok, "expected a field, got %q", fieldTok.text)
+	}
+	field := strings.ToLower(fieldTok.text)
+
+	var player string
+	if (field == "score" || field == "placement" || field == "chips") && p.peek().kind == tokLParen {
+		p.next()
+		tok, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		player = tok.text
+		if err = p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokOp {
+		return nil, p.errorf(opTok, "expected a comparison after %s, got %q", fieldTok.text, opTok.text)
+	}
+
+	switch field {
+	case "players":
+		return p.parsePlayers(opTok)
+	case "lobby":
+		return p.stringCondition(opTok, func(f lineFields) string { return f.Lobby }, nil)
+	case "mode":
+		return p.stringCondition(opTok, func(f lineFields) string { return f.Mode.Raw }, nil)
+	case "mode.tier":
+		return p.stringCondition(opTok, func(f lineFields) string { return f.Mode.Tier }, []string{"ippan", "joukyuu", "tokujou", "houou"})
+	case "mode.length":
+		return p.stringCondition(opTok, func(f lineFields) string { return f.Mode.Length }, []string{"tonpuu", "hanchan"})
+	case "mode.kuitan":
+		return p.boolCondition(opTok, func(f lineFields) bool { return f.Mode.Kuitan })
+	case "mode.red":
+		return p.boolCondition(opTok, func(f lineFields) bool { return f.Mode.Red })
+	case "mode.fast":
+		return p.boolCondition(opTok, func(f lineFields) bool { return f.Mode.Fast })
+	case "mode.players":
+		return p.numberCondition(opTok, func(f lineFields, aliases UserListing, ok func(float64) bool) bool {
+			return ok(float64(f.Mode.Players))
+		})
+	case "time":
+		return p.timeCondition(opTok)
+	case "score":
+		return p.numberCondition(opTok, scoreCondition(player, func(s UserScore) (float64, bool) {
+			return float64(s.Score), true
+		}))
+	case "placement":
+		return p.numberCondition(opTok, scoreCondition(player, func(s UserScore) (float64, bool) {
+			return float64(s.Placement), true
+		}))
+	case "chips":
+		return p.numberCondition(opTok, scoreCondition(player, func(s UserScore) (float64, bool) {
+			if s.Chips == nil {
+				return 0, false
+			}
+			return float64(*s.Chips), true
+		}))
+	default:
+		return nil, p.errorf(fieldTok, "unknown field %s", fieldTok.text)
+	}
+}
+
+func (p *filterParser) parsePlayers(op filterToken) (matcher, error) {
+	if op.text != "has" {
+		return nil, p.errorf(op, "players can only be used with has")
+	}
+
+	all := true
+	var names []filterToken
+	if p.keyword("all") {
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		names = list
+	} else if p.keyword("any") {
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		names, all = list, false
+	} else {
+		tok, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		names = []filterToken{tok}
+	}
+
+	return func(f lineFields, aliases UserListing) bool {
+		for _, name := range names {
+			found := false
+			for _, score := range f.Score {
+				if isPlayer(score, name.text, aliases) {
+					found = true
+					break
+				}
+			}
+			if found != all {
+				return found
+			}
+		}
+		return all
+	}, nil
+}
+
+func compareOp(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func (p *filterParser) stringCondition(op filterToken, get func(lineFields) string, allowed []string) (matcher, error) {
+	if op.text == "has" {
+		return nil, p.errorf(op, "has can only be used with players")
+	}
+	v, err := p.parseValues(op)
+	if err != nil {
+		return nil, err
+	}
+	if allowed != nil {
+		for _, tok := range append(v.values, v.lo, v.hi) {
+			if tok.kind == tokEOF {
+				continue
+			}
+			tok.text = strings.ToLower(tok.text)
+			valid := false
+			for _, a := range allowed {
+				valid = valid || tok.text == a
+			}
+			if !valid {
+				return nil, p.errorf(tok, "invalid value %q, expecting one of %s", tok.text, strings.Join(allowed, ", "))
+			}
+		}
+	}
+	fold := func(s string) string {
+		if allowed != nil {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+
+	return func(f lineFields, aliases UserListing) bool {
+		value := get(f)
+		switch {
+		case v.isRange:
+			return strings.Compare(value, fold(v.lo.text)) >= 0 && strings.Compare(value, fold(v.hi.text)) <= 0
+		case v.op == "in":
+			for _, tok := range v.values {
+				if value == fold(tok.text) {
+					return true
+				}
+			}
+			return false
+		default:
+			return compareOp(v.op, strings.Compare(value, fold(v.values[0].text)))
+		}
+	}, nil
+}
+
+func (p *filterParser) boolCondition(op filterToken, get func(lineFields) bool) (matcher, error) {
+	if op.text != "=" && op.text != "!=" {
+		return nil, p.errorf(op, "true or false can only be compared with = or !=")
+	}
+	tok, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	b, err := strconv.ParseBool(tok.text)
+	if err != nil {
+		return nil, p.errorf(tok, "expected true or false, got %q", tok.text)
+	}
+	return func(f lineFields, aliases UserListing) bool {
+		return (get(f) == b) == (op.text == "=")
+	}, nil
+}
+
+// scoreCondition matches lines where the condition holds for player, or for
+// any player at the table if player is empty.
+func scoreCondition(player string, get func(UserScore) (float64, bool)) func(lineFields, UserListing, func(float64) bool) bool {
+	return func(f lineFields, aliases UserListing, ok func(float64) bool) bool {
+		for _, score := range f.Score {
+			if player != "" && !isPlayer(score, player, aliases) {
+				continue
+			}
+			if value, present := get(score); present && ok(value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (p *filterParser) parseNumber(tok filterToken) (float64, error) {
+	n, err := strconv.ParseFloat(tok.text, 64)
+	if err != nil {
+		return 0, p.errorf(tok, "expected a number, got %q", tok.text)
+	}
+	return n, nil
+}
+
+func (p *filterParser) numberCondition(op filterToken, match func(lineFields, UserListing, func(float64) bool) bool) (matcher, error) {
+	if op.text == "has" {
+		return nil, p.errorf(op, "has can only be used with players")
+	}
+	v, err := p.parseValues(op)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok func(float64) bool
+	switch {
+	case v.isRange:
+		lo, err := p.parseNumber(v.lo)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := p.parseNumber(v.hi)
+		if err != nil {
+			return nil, err
+		}
+		ok = func(n float64) bool { return lo <= n && n <= hi }
+	case v.op == "in":
+		var set []float64
+		for _, tok := range v.values {
+			n, err := p.parseNumber(tok)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, n)
+		}
+		ok = func(n float64) bool {
+			for _, s := range set {
+				if n == s {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		want, err := p.parseNumber(v.values[0])
+		if err != nil {
+			return nil, err
+		}
+		ok = func(n float64) bool {
+			switch {
+			case n < want:
+				return compareOp(v.op, -1)
+			case n > want:
+				return compareOp(v.op, 1)
+			}
+			return compareOp(v.op, 0)
+		}
+	}
+
+	return func(f lineFields, aliases UserListing) bool {
+		return match(f, aliases, ok)
+	}, nil
+}
+
+func (p *filterParser) parseTimeOfDay(tok filterToken) (int, error) {
+	t, err := time.Parse("15:04", tok.text)
+	if err != nil {
+		return 0, p.errorf(tok, "expected a time of day HH:MM, got %q", tok.text)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// timeCondition compares the start time of day. Ranges wrap around
+// midnight when their end is before their start, e.g. 22:00..02:00.
+func (p *filterParser) timeCondition(op filterToken) (matcher, error) {
+	if op.text == "has" {
+		return nil, p.errorf(op, "has can only be used with players")
+	}
+	v, err := p.parseValues(op)
+	if err != nil {
+		return nil, err
+	}
+	if v.op == "in" && !v.isRange {
+		return nil, p.errorf(op, "time can only be in a range HH:MM..HH:MM")
+	}
+
+	minutes := func(f lineFields) int {
+		return f.Start.Hour()*60 + f.Start.Minute()
+	}
+	if v.isRange {
+		lo, err := p.parseTimeOfDay(v.lo)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := p.parseTimeOfDay(v.hi)
+		if err != nil {
+			return nil, err
+		}
+		return func(f lineFields, aliases UserListing) bool {
+			m := minutes(f)
+			if lo <= hi {
+				return lo <= m && m <= hi
+			}
+			return m >= lo || m <= hi
+		}, nil
+	}
+
+	want, err := p.parseTimeOfDay(v.values[0])
+	if err != nil {
+		return nil, err
+	}
+	return func(f lineFields, aliases UserListing) bool {
+		return compareOp(v.op, minutes(f)-want)
+	}, nil
+}
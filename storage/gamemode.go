@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GameMode is a decoded Tenhou rule string such as 四般東喰赤 or 三鳳南喰赤速.
+type GameMode struct {
+	Raw     string
+	Players int
+	// Tier is one of ippan, joukyuu, tokujou or houou, empty if the rule
+	// string doesn't name one
+	Tier string
+	// Length is tonpuu or hanchan
+	Length string
+	Kuitan bool
+	Red    bool
+	Fast   bool
+}
+
+func ParseGameMode(raw string) GameMode {
+	m := GameMode{Raw: raw}
+	for _, r := range raw {
+		switch r {
+		case '四':
+			m.Players = 4
+		case '三':
+			m.Players = 3
+		case '般':
+			m.Tier = "ippan"
+		case '上':
+			m.Tier = "joukyuu"
+		case '特':
+			m.Tier = "tokujou"
+		case '鳳':
+			m.Tier = "houou"
+		case '東':
+			m.Length = "tonpuu"
+		case '南':
+			m.Length = "hanchan"
+		case '喰':
+			m.Kuitan = true
+		case '赤':
+			m.Red = true
+		case '速':
+			m.Fast = true
+		}
+	}
+	return m
+}
+
+func (m GameMode) String() string {
+	return m.Raw
+}
+
+// GameModeFilter matches game modes on any of their decoded fields. Zero
+// values match every game mode.
+type GameModeFilter struct {
+	Players int
+	Tier    string
+	Length  string
+	Kuitan  *bool
+	Red     *bool
+	Fast    *bool
+}
+
+// parseFilterBool parses true or false into a *bool, nil when empty.
+func parseFilterBool(name, value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid value %q for %s, expecting true or false", value, name)
+	}
+	return &b, nil
+}
+
+// NewGameModeFilter builds a filter from the textual values of the grep
+// flags, where empty values match everything.
+func NewGameModeFilter(players int, tier, length, kuitan, red, fast string) (GameModeFilter, error) {
+	f := GameModeFilter{Players: players, Tier: strings.ToLower(tier), Length: strings.ToLower(length)}
+	switch f.Tier {
+	case "", "ippan", "joukyuu", "tokujou", "houou":
+	default:
+		return f, fmt.Errorf("Invalid tier %q, expecting ippan, joukyuu, tokujou or houou", tier)
+	}
+	switch f.Length {
+	case "", "tonpuu", "hanchan":
+	default:
+		return f, fmt.Errorf("Invalid length %q, expecting tonpuu or hanchan", length)
+	}
+	if players != 0 && players != 3 && players != 4 {
+		return f, fmt.Errorf("Invalid number of players %d, expecting 3 or 4", players)
+	}
+
+	var err error
+	if f.Kuitan, err = parseFilterBool("kuitan", kuitan); err != nil {
+		return f, err
+	}
+	if f.Red, err = parseFilterBool("red", red); err != nil {
+		return f, err
+	}
+	if f.Fast, err = parseFilterBool("fast", fast); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func (f GameModeFilter) Match(m GameMode) bool {
+	switch {
+	case f.Players != 0 && f.Players != m.Players:
+		return false
+	case f.Tier != "" && f.Tier != m.Tier:
+		return false
+	case f.Length != "" && f.Length != m.Length:
+		return false
+	case f.Kuitan != nil && *f.Kuitan != m.Kuitan:
+		return false
+	case f.Red != nil && *f.Red != m.Red:
+		return false
+	case f.Fast != nil && *f.Fast != m.Fast:
+		return false
+	}
+	return true
+}
@@ -22,15 +22,33 @@ func (e walkFileError) IsNotExist() bool {
 	return os.IsNotExist(e.err)
 }
 
-func (a LogArchive) GrepLogs(lobby string, aliases UserListing, startDate time.Time, endDate time.Time, logs chan SCxLogLine, errChan chan error, done chan int) {
+// matchUsers reports whether any player is in aliases, replacing their
+// names with the user they belong to.
+func matchUsers(scores []UserScore, aliases UserListing) bool {
+	match := false
+	for i, score := range scores {
+		userName, ok := aliases.User(score.UserName)
+		if ok {
+			scores[i].UserName = userName
+			match = true
+		}
+	}
+	return match
+}
+
+// GrepLogs searches the sca logs of a lobby, the scb logs for L0000, or all
+// logs of a type when lobby is one of sca, scb, scc, scd or sce.
+func (a LogArchive) GrepLogs(lobby string, aliases UserListing, filter LineFilter, startDate time.Time, endDate time.Time, logs chan SCxLogLine, errChan chan error, done chan int) {
 	defer func() { done <- 1 }()
 
-	if !(lobby[0] == 'L') || len(lobby) != 5 {
-		errChan <- fmt.Errorf("Invalid Lobby Format, expecting L[0-9]{4}, got %s", lobby)
-		return
-	}
 	var scx string = "sca"
-	if lobby == "L0000" {
+	switch {
+	case lobby == "sca" || lobby == "scb" || lobby == "scc" || lobby == "scd" || lobby == "sce":
+		scx, lobby = lobby, ""
+	case !(lobby[0] == 'L') || len(lobby) != 5:
+		errChan <- fmt.Errorf("Invalid Lobby Format, expecting L[0-9]{4} or a log type, got %s", lobby)
+		return
+	case lobby == "L0000":
 		scx = "scb"
 	}
 
@@ -59,38 +77,40 @@ func (a LogArchive) GrepLogs(lobby string, aliases UserListing, startDate time.T
 			}
 
 			for scxLog.Scan() {
-				switch v := scxLog.Token().(type) {
+				line := scxLog.Token()
+				// The filter sees player names as they are in the log,
+				// before matchUsers replaces them with their users
+				if filter != nil && !filter.MatchLine(line, aliases) {
+					continue
+				}
+				var match bool
+				switch v := line.(type) {
 				case *SCALogLine:
-					if v.Lobby != lobby {
+					if lobby != "" && v.Lobby != lobby {
 						continue
 					}
-					match := false
-					for i, score := range(v.Score) {
-						userName, ok := aliases.User(score.UserName)
-						if ok {
-							v.Score[i].UserName = userName
-							match = true
-						}
-					}
-					if !match {
-						continue
-					}
-					logs <- v
+					match = matchUsers(v.Score, aliases)
 				case *SCBLogLine:
-					match := false
+					match = false
 					for _, score := range(v.Score) {
 						_, ok := aliases.User(score.UserName)
 						if ok {
 							match = true
 						}
 					}
-					if !match {
-						continue
-					}
-					logs <- v
+				case *SCCLogLine:
+					match = matchUsers(v.Score, aliases)
+				case *SCDLogLine:
+					match = matchUsers(v.Score, aliases)
+				case *SCELogLine:
+					match = matchUsers(v.Score, aliases)
 				default:
 					return walkFileError{path, errors.New("Support for Log Type not yet implemented")}
 				}
+				if !match {
+					continue
+				}
+				logs <- line
 			}
 			if err = scxLog.Err(); err != nil {
 				return walkFileError{path, err}
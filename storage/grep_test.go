@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestLog(t *testing.T, path string, data string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzLog := gzip.NewWriter(file)
+	if _, err = gzLog.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err = gzLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func grepTestLogs(t *testing.T, a LogArchive, lobby string, aliases UserListing, filter LineFilter, date time.Time) []string {
+	logs := make(chan SCxLogLine, 100)
+	errChan := make(chan error, 1)
+	done := make(chan int, 1)
+	a.GrepLogs(lobby, aliases, filter, date, date, logs, errChan, done)
+	close(logs)
+	select {
+	case err := <-errChan:
+		t.Fatal(err)
+	default:
+	}
+
+	var lines []string
+	for line := range logs {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+func TestGrepFilterPlayers(t *testing.T) {
+	japan, _ := time.LoadLocation("Japan")
+	date := time.Date(2019, 01, 01, 00, 00, 00, 00, japan)
+	a := LogArchive{PathRoot: t.TempDir()}
+	writeTestLog(t, filepath.Join(a.PathRoot, "sca", "2019", "01", "sca20190101.log.gz"),
+		"L1234 | 00:03 | 四般南喰赤 | alice(+23.5) bob(+7.0) carol(-15.0) dave(-15.5)\n")
+	writeTestLog(t, filepath.Join(a.PathRoot, "scb", "2019", "01", "scb20190101.log.gz"),
+		"00:03 | 21 | 四般南喰赤 | alice(+23.5) bob(+7.0) carol(-15.0) dave(-15.5)\n")
+
+	var aliases UserListing
+	aliases.Parse(UserStorage{"Team": {"alice"}})
+
+	for _, lobby := range []string{"L1234", "L0000"} {
+		for _, expr := range []string{"players has alice", "players has Team", `players has all(alice, bob)`, "placement(alice) = 1"} {
+			filter, err := ParseFilter(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := grepTestLogs(t, a, lobby, aliases, filter, date); len(lines) != 1 {
+				t.Errorf("grep %s -filter %q = %q, want 1 line", lobby, expr, lines)
+			}
+		}
+
+		filter, err := ParseFilter("players has erin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := grepTestLogs(t, a, lobby, aliases, filter, date); len(lines) != 0 {
+			t.Errorf("grep %s -filter %q = %q, want no lines", lobby, "players has erin", lines)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HououDir returns where a houou table game log is stored, sorted by the
+// month it was played in.
+func HououDir(date time.Time) string {
+	return filepath.Join("houou", date.Format("2006"), date.Format("01"))
+}
+
+// GetHououLogs sends every game linked from the scc logs between start and
+// end that one of the users in aliases played in.
+func (a LogArchive) GetHououLogs(start, end time.Time, aliases UserListing, logs chan UserLogInfo, errChan chan error) {
+	defer close(logs)
+
+	seen := make(map[string]bool)
+	for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location()); !month.After(end); month = month.AddDate(0, 1, 0) {
+		dir := filepath.Join(a.PathRoot, "scc", month.Format("2006"), month.Format("01"))
+		names, err := readDirNames(dir)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if len(name) < 11 || !strings.HasPrefix(name, "scc") || !strings.HasSuffix(name, ".html.gz") {
+				continue
+			}
+			date, err := time.ParseInLocation("20060102", name[3:11], start.Location())
+			if err != nil || date.Before(start) || date.After(end) {
+				continue
+			}
+
+			scxLog, err := InitSCxLogParser(filepath.Join(dir, name))
+			if err != nil {
+				errChan <- walkFileError{name, err}
+				return
+			}
+			for scxLog.Scan() {
+				v, ok := scxLog.Token().(*SCCLogLine)
+				if !ok || seen[v.LogID] || !matchUsers(v.Score, aliases) {
+					continue
+				}
+				// Hourly and daily scc logs of the same day overlap
+				seen[v.LogID] = true
+				logs <- UserLogInfo{LogID: v.LogID, Dir: HououDir(v.StartTime)}
+			}
+			err = scxLog.Err()
+			scxLog.Close()
+			if err != nil {
+				errChan <- walkFileError{name, err}
+				return
+			}
+		}
+	}
+}
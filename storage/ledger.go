@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	FailedUserLog = "user"
+	FailedSCx     = "scx"
+	FailedSCRAW   = "scraw"
+)
+
+// FailedFetch is a download that failed. Item is the log ID for user logs,
+// the file name from list.cgi for SCx logs and the zip name for SCRAW logs.
+type FailedFetch struct {
+	Kind      string    `json:"kind"`
+	Item      string    `json:"item"`
+	User      string    `json:"user,omitempty"`
+	Dir       string    `json:"dir,omitempty"`
+	Error     string    `json:"error"`
+	Permanent bool      `json:"permanent"`
+	Attempts  int       `json:"attempts"`
+	Time      time.Time `json:"time"`
+}
+
+func (f FailedFetch) key() string {
+	return f.Kind + ":" + f.Item
+}
+
+type FailureLedger struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]FailedFetch
+}
+
+func (a LogArchive) ReadFailureLedger() (*FailureLedger, error) {
+	l := &FailureLedger{
+		path:    filepath.Join(a.PathRoot, "failed.index"),
+		entries: make(map[string]FailedFetch),
+	}
+
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return l, err
+	}
+	defer file.Close()
+
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var f FailedFetch
+		err = json.Unmarshal(lines.Bytes(), &f)
+		if err != nil {
+			return l, err
+		}
+		l.entries[f.key()] = f
+	}
+	return l, lines.Err()
+}
+
+func (l *FailureLedger) Record(f FailedFetch) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f.Attempts = l.entries[f.key()].Attempts + 1
+	l.entries[f.key()] = f
+}
+
+func (l *FailureLedger) Clear(f FailedFetch) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, f.key())
+}
+
+func (l *FailureLedger) IsPermanent(f FailedFetch) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.entries[f.key()].Permanent
+}
+
+func (l *FailureLedger) Entries() []FailedFetch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ret := make([]FailedFetch, 0, len(l.entries))
+	for _, f := range l.entries {
+		ret = append(ret, f)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].key() < ret[j].key() })
+	return ret
+}
+
+func (l *FailureLedger) Write() error {
+	entries := l.Entries()
+	if len(entries) == 0 {
+		err := os.Remove(l.path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	file, err := createAtomic(l.path)
+	if err != nil {
+		return err
+	}
+
+	wrLines := bufio.NewWriter(file)
+	enc := json.NewEncoder(wrLines)
+	for _, f := range entries {
+		if err = enc.Encode(f); err != nil {
+			file.Abort()
+			return err
+		}
+	}
+	if err = wrLines.Flush(); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
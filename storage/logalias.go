@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+type LogAlias struct {
+	Alias string `json:"alias"`
+	Log   string `json:"log"`
+}
+
+func (a LogArchive) logAliasPath() string {
+	return filepath.Join(a.PathRoot, "logAliases.index")
+}
+
+func (a LogArchive) ReadLogAliases() (map[string]string, error) {
+	aliases := make(map[string]string)
+
+	file, err := os.Open(a.logAliasPath())
+	if os.IsNotExist(err) {
+		return aliases, nil
+	} else if err != nil {
+		return aliases, err
+	}
+	defer file.Close()
+
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var alias LogAlias
+		err = json.Unmarshal(lines.Bytes(), &alias)
+		if err != nil {
+			return aliases, err
+		}
+		aliases[alias.Alias] = alias.Log
+	}
+	return aliases, lines.Err()
+}
+
+var logAliasLock sync.Mutex
+
+func (a LogArchive) AddLogAlias(alias string, logID string) error {
+	logAliasLock.Lock()
+	defer logAliasLock.Unlock()
+
+	aliases, err := a.ReadLogAliases()
+	if err != nil {
+		return err
+	}
+	if aliases[alias] == logID {
+		return nil
+	}
+	aliases[alias] = logID
+
+	keys := make([]string, 0, len(aliases))
+	for k := range aliases {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	file, err := createAtomic(a.logAliasPath())
+	if err != nil {
+		return err
+	}
+
+	wrLines := bufio.NewWriter(file)
+	enc := json.NewEncoder(wrLines)
+	for _, k := range keys {
+		if err = enc.Encode(LogAlias{Alias: k, Log: aliases[k]}); err != nil {
+			file.Abort()
+			return err
+		}
+	}
+	if err = wrLines.Flush(); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
+
+func (a LogArchive) ResolveLogAlias(logID string) (string, error) {
+	aliases, err := a.ReadLogAliases()
+	if err != nil {
+		return logID, err
+	}
+	if canonical, ok := aliases[logID]; ok {
+		return canonical, nil
+	}
+	return logID, nil
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"bufio"
+	"encoding/json"
 	"os"
 	"path/filepath"
 )
@@ -16,30 +17,29 @@ type UserLogSet struct {
 
 func (l UserLogSet) Write() error {
 	fPath := filepath.Join(l.Path, "user", l.User, "localLogs.index")
-	file, err := os.OpenFile(fPath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
-	if os.IsNotExist(err) {
-		err = os.MkdirAll(filepath.Dir(fPath), 0755)
-		if err != nil {
-			return err
-		}
-		return l.Write()
-	} else if err != nil {
+	file, err := createAtomic(fPath)
+	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	wrLines := bufio.NewWriter(file)
 	for data := range l.Logs {
 		_, err = wrLines.WriteString(data)
 		if err != nil {
+			file.Abort()
 			return err
 		}
 		err = wrLines.WriteByte(0x0A)
 		if err != nil {
+			file.Abort()
 			return err
 		}
 	}
-	return wrLines.Flush()
+	if err = wrLines.Flush(); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
 }
 
 func (l *UserLogSet) Read() error {
@@ -61,3 +61,34 @@ func (l *UserLogSet) Read() error {
 
 	return nil
 }
+
+func (a LogArchive) AddUserLogEntries(user string, entries []TenhouLocalStorage) error {
+	logSet := UserLogSet{Path: a.PathRoot, User: user, Logs: make(LogSet)}
+	err := logSet.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	known := make(map[string]bool)
+	for data := range logSet.Logs {
+		var entry TenhouLocalStorage
+		if err = json.Unmarshal([]byte(data), &entry); err != nil {
+			return err
+		}
+		known[entry.Log] = true
+	}
+
+	for _, entry := range entries {
+		if known[entry.Log] {
+			continue
+		}
+		known[entry.Log] = true
+
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		logSet.Logs[string(b)] = true
+	}
+	return logSet.Write()
+}
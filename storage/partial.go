@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const partialSuffix = ".part"
+
+// PartialDownload describes an interrupted download kept next to its
+// destination, along with the validators of the response it came from so
+// that it can be resumed with a Range request.
+type PartialDownload struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Length       int64  `json:"length"`
+
+	// Size is the number of bytes already on disk
+	Size int64 `json:"-"`
+}
+
+// Validator returns the value to send in If-Range, or "" if the partial
+// download cannot be resumed safely.
+func (p PartialDownload) Validator() string {
+	if p.ETag != "" && !(len(p.ETag) > 2 && p.ETag[:2] == "W/") {
+		return p.ETag
+	}
+	return p.LastModified
+}
+
+func partialMetaPath(fPath string) string {
+	return fPath + partialSuffix + ".json"
+}
+
+func readPartial(fPath string) (PartialDownload, bool, error) {
+	var p PartialDownload
+
+	info, err := os.Stat(fPath + partialSuffix)
+	if os.IsNotExist(err) {
+		return p, false, nil
+	} else if err != nil {
+		return p, false, err
+	}
+
+	b, err := ioutil.ReadFile(partialMetaPath(fPath))
+	if os.IsNotExist(err) {
+		// Data without metadata can't be validated, start over
+		return p, false, removePartial(fPath)
+	} else if err != nil {
+		return p, false, err
+	}
+	if err = json.Unmarshal(b, &p); err != nil {
+		return p, false, removePartial(fPath)
+	}
+	p.Size = info.Size()
+	return p, true, nil
+}
+
+func removePartial(fPath string) error {
+	err := os.Remove(fPath + partialSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(partialMetaPath(fPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// partialFile is a download written to <path>.part. Commit moves it into
+// place once complete, while Abort keeps it on disk so it can be resumed.
+type partialFile struct {
+	*os.File
+	path string
+}
+
+func openPartial(fPath string, p PartialDownload, offset int64) (*partialFile, error) {
+	err := os.MkdirAll(filepath.Dir(fPath), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := createAtomic(partialMetaPath(fPath))
+	if err != nil {
+		return nil, err
+	}
+	if err = json.NewEncoder(meta).Encode(p); err != nil {
+		meta.Abort()
+		return nil, err
+	}
+	if err = meta.Commit(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(fPath+partialSuffix, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = file.Truncate(offset); err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &partialFile{File: file, path: fPath}, nil
+}
+
+func (f *partialFile) Commit() error {
+	err := f.File.Sync()
+	if err != nil {
+		f.File.Close()
+		return err
+	}
+	err = f.File.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(f.File.Name(), f.path)
+	if err != nil {
+		return err
+	}
+	os.Remove(partialMetaPath(f.path))
+	return syncDir(filepath.Dir(f.path))
+}
+
+func (f *partialFile) Abort() error {
+	f.File.Sync()
+	return f.File.Close()
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// scrawEntry parses the name of a daily log inside a yearly SCRAW zip, such
+// as 2019/scc20190101.html.gz, returning the log type, its date and the
+// file name it is stored under in the archive.
+func scrawEntry(name string, japan *time.Location) (scx string, date time.Time, fName string, ok bool) {
+	base := path.Base(name)
+	if len(base) < 11 {
+		return
+	}
+	switch scx = base[:3]; scx {
+	case "sca", "scb", "scc", "scd", "sce":
+	default:
+		return
+	}
+	date, err := time.ParseInLocation("20060102", base[3:11], japan)
+	if err != nil {
+		return
+	}
+	// Older archives contain some logs without compression
+	fName = base
+	if !strings.HasSuffix(fName, ".gz") {
+		fName += ".gz"
+	}
+	return scx, date, fName, true
+}
+
+// UnpackSCRAW extracts the daily logs between start and end from the SCRAW
+// zip for year into the <scx>/<yyyy>/<mm>/ layout used for daily logs.
+// Zero start or end dates leave the range open. Logs that already exist are
+// kept, and the number of extracted logs is returned.
+func (a LogArchive) UnpackSCRAW(year int, start, end time.Time) (int, error) {
+	japan, err := time.LoadLocation("Japan")
+	if err != nil {
+		return 0, err
+	}
+
+	zipLog, err := zip.OpenReader(a.AddSCRAWLogInfo(year).path)
+	if err != nil {
+		return 0, err
+	}
+	defer zipLog.Close()
+
+	var n int
+	for _, entry := range zipLog.File {
+		scx, date, fName, ok := scrawEntry(entry.Name, japan)
+		if !ok || (!start.IsZero() && date.Before(start)) || (!end.IsZero() && date.After(end)) {
+			continue
+		}
+
+		logInfo := a.AddSCxLogInfo(scx, date, fName)
+		if exists, err := logInfo.Exists(); err != nil {
+			return n, err
+		} else if exists {
+			continue
+		}
+
+		if err = unpackSCRAWEntry(&logInfo, entry, fName != path.Base(entry.Name)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func unpackSCRAWEntry(logInfo *SCxLogInfo, entry *zip.File, compress bool) error {
+	r, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err = logInfo.Open(); err != nil {
+		return err
+	}
+
+	var w io.Writer = logInfo
+	var gzLog *gzip.Writer
+	if compress {
+		gzLog, _ = gzip.NewWriterLevel(logInfo, gzip.BestCompression)
+		w = gzLog
+	}
+	wrLog := bufio.NewWriter(w)
+	// Reading the entry to EOF verifies its checksum
+	_, err = wrLog.ReadFrom(r)
+	if err == nil {
+		err = wrLog.Flush()
+	}
+	if err == nil && gzLog != nil {
+		err = gzLog.Close()
+	}
+	if err != nil {
+		logInfo.Abort()
+		return err
+	}
+	return logInfo.Close()
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCCLogLine is a game from the houou table, linked to its game log.
+type SCCLogLine struct {
+	StartTime time.Time
+	Duration  string
+	GameMode  GameMode
+	LogID     string
+	Score     []UserScore
+}
+
+// SCDLogLine and SCELogLine hold lines from the scd and sce logs. Their
+// layout isn't documented, so the lobby, duration and log link columns are
+// all optional and left empty when missing. Lines that don't fit at all are
+// kept whole in Raw rather than failing the whole file.
+type SCDLogLine struct {
+	Lobby     string
+	StartTime time.Time
+	Duration  string
+	GameMode  GameMode
+	LogID     string
+	Score     []UserScore
+	Raw       string `json:",omitempty"`
+}
+
+type SCELogLine SCDLogLine
+
+type scxFields struct {
+	Lobby    string
+	Start    time.Duration
+	Duration string
+	GameMode GameMode
+	LogID    string
+	Score    []UserScore
+}
+
+// isLobby accepts lobbies such as L1234 and tournament lobbies such as
+// C12345678.
+func isLobby(field string) bool {
+	if len(field) < 5 || (field[0] != 'L' && field[0] != 'C') {
+		return false
+	}
+	_, err := strconv.ParseUint(field[1:], 10, 64)
+	return err == nil
+}
+
+// parseLogLink extracts the log ID from a viewer link such as
+// <a href="http://tenhou.net/0/?log=2019010100gm-00a9-0000-0123abcd">牌譜</a>.
+func parseLogLink(field string) (string, error) {
+	i := strings.Index(field, "log=")
+	if i == -1 {
+		return "", fmt.Errorf("No log ID in link %s", field)
+	}
+	logID := field[i+len("log="):]
+	if end := strings.IndexAny(logID, "&\"'>"); end != -1 {
+		logID = logID[:end]
+	}
+	if logID == "" {
+		return "", fmt.Errorf("No log ID in link %s", field)
+	}
+	return logID, nil
+}
+
+func parseSCxFields(data string) (scxFields, error) {
+	var f scxFields
+
+	data = strings.TrimSpace(data)
+	data = strings.TrimSpace(strings.TrimSuffix(data, "<br>"))
+	fields := strings.Split(data, " | ")
+
+	if len(fields) > 0 && isLobby(fields[0]) {
+		f.Lobby = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) < 3 {
+		return f, fmt.Errorf("Error while parsing line; expected at least 3 fields, got %v", len(fields))
+	}
+
+	start, err := time.Parse("15:04", fields[0])
+	if err != nil {
+		return f, err
+	}
+	f.Start = time.Hour*time.Duration(start.Hour()) + time.Minute*time.Duration(start.Minute())
+	fields = fields[1:]
+
+	if _, err := strconv.Atoi(fields[0]); err == nil {
+		f.Duration = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) < 2 {
+		return f, fmt.Errorf("Error while parsing line; missing game mode or scores")
+	}
+	f.GameMode = ParseGameMode(fields[0])
+	fields = fields[1:]
+
+	if strings.Contains(fields[0], "<a ") {
+		f.LogID, err = parseLogLink(fields[0])
+		if err != nil {
+			return f, err
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return f, fmt.Errorf("Error while parsing line; unexpected fields after scores")
+	}
+
+	f.Score, err = parseUserScores(fields[0], f.GameMode.Players)
+	return f, err
+}
+
+func (ll *SCCLogLine) Parse(data string, date time.Time) error {
+	f, err := parseSCxFields(data)
+	if err != nil {
+		return err
+	}
+	if f.LogID == "" {
+		return fmt.Errorf("Error while parsing line; no log link")
+	}
+
+	ll.StartTime = date.Add(f.Start)
+	ll.Duration = f.Duration
+	ll.GameMode = f.GameMode
+	ll.LogID = f.LogID
+	ll.Score = f.Score
+	return nil
+}
+
+func (ll SCCLogLine) String() string {
+	var b strings.Builder
+	b.WriteString(ll.StartTime.Format("15:04"))
+	b.WriteString(" | ")
+	b.WriteString(ll.Duration)
+	b.WriteString(" | ")
+	b.WriteString(ll.GameMode.Raw)
+	b.WriteString(" | ")
+	b.WriteString(ll.LogID)
+	writeScores(&b, ll.Score)
+	return b.String()
+}
+
+func (ll *SCCLogLine) Clone() SCxLogLine {
+	tmp := *ll
+	return &tmp
+}
+
+func (ll *SCDLogLine) Parse(data string, date time.Time) error {
+	f, err := parseSCxFields(data)
+	if err != nil {
+		*ll = SCDLogLine{StartTime: date, Raw: strings.TrimSpace(data)}
+		return nil
+	}
+
+	ll.Raw = ""
+	ll.Lobby = f.Lobby
+	ll.StartTime = date.Add(f.Start)
+	ll.Duration = f.Duration
+	ll.GameMode = f.GameMode
+	ll.LogID = f.LogID
+	ll.Score = f.Score
+	return nil
+}
+
+func (ll SCDLogLine) String() string {
+	if ll.Raw != "" {
+		return ll.Raw
+	}
+	var b strings.Builder
+	if ll.Lobby != "" {
+		b.WriteString(ll.Lobby)
+		b.WriteString(" | ")
+	}
+	b.WriteString(ll.StartTime.Format("15:04"))
+	if ll.Duration != "" {
+		b.WriteString(" | ")
+		b.WriteString(ll.Duration)
+	}
+	b.WriteString(" | ")
+	b.WriteString(ll.GameMode.Raw)
+	if ll.LogID != "" {
+		b.WriteString(" | ")
+		b.WriteString(ll.LogID)
+	}
+	writeScores(&b, ll.Score)
+	return b.String()
+}
+
+func (ll *SCDLogLine) Clone() SCxLogLine {
+	tmp := *ll
+	return &tmp
+}
+
+func (ll *SCELogLine) Parse(data string, date time.Time) error {
+	return (*SCDLogLine)(ll).Parse(data, date)
+}
+
+func (ll SCELogLine) String() string {
+	return SCDLogLine(ll).String()
+}
+
+func (ll *SCELogLine) Clone() SCxLogLine {
+	tmp := *ll
+	return &tmp
+}
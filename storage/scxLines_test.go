@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSCCLogLineParse(t *testing.T) {
+	japan, _ := time.LoadLocation("Japan")
+	date := time.Date(2019, 01, 01, 00, 00, 00, 00, japan)
+	data := `00:07 | 13 | 四鳳南喰赤－ | <a href="http://tenhou.net/0/?log=2019010100gm-00a9-0000-f9cf8b8a">牌譜</a> | たろう(+61.0) はなこ(+8.0) じろう(-22.0) さぶろう(-47.0)<br>`
+
+	var ll SCCLogLine
+	if err := ll.Parse(data, date); err != nil {
+		t.Fatal(err)
+	}
+	if !ll.StartTime.Equal(date.Add(7 * time.Minute)) {
+		t.Errorf("StartTime = %s", ll.StartTime)
+	}
+	if ll.Duration != "13" {
+		t.Errorf("Duration = %q", ll.Duration)
+	}
+	if ll.LogID != "2019010100gm-00a9-0000-f9cf8b8a" {
+		t.Errorf("LogID = %q", ll.LogID)
+	}
+	want := GameMode{Raw: "四鳳南喰赤－", Players: 4, Tier: "houou", Length: "hanchan", Kuitan: true, Red: true}
+	if ll.GameMode != want {
+		t.Errorf("GameMode = %+v, want %+v", ll.GameMode, want)
+	}
+	if len(ll.Score) != 4 || ll.Score[0].UserName != "たろう" || ll.Score[0].Score != 61 || ll.Score[3].Score != -47 {
+		t.Errorf("Score = %+v", ll.Score)
+	}
+}
+
+func TestSCDLogLineParse(t *testing.T) {
+	japan, _ := time.LoadLocation("Japan")
+	date := time.Date(2019, 01, 01, 00, 00, 00, 00, japan)
+	tests := []struct {
+		data  string
+		lobby string
+		raw   bool
+	}{
+		{"L1234 | 00:07 | 四般東喰赤 | a(+38.0) b(+9.0) c(-12.0) d(-35.0)", "L1234", false},
+		{"C12345678 | 00:07 | 三般南喰赤 | a(+38.0,+2枚) b(-3.0,0枚) c(-35.0,-2枚)", "C12345678", false},
+		{"00:07 | 15 | 四般南喰赤 | a(+38.0) b(+9.0) c(-12.0) d(-35.0)", "", false},
+		{"something else entirely", "", true},
+	}
+	for _, test := range tests {
+		var ll SCDLogLine
+		if err := ll.Parse(test.data, date); err != nil {
+			t.Errorf("Parse(%q): %s", test.data, err)
+			continue
+		}
+		if ll.Lobby != test.lobby {
+			t.Errorf("Parse(%q) lobby = %q, want %q", test.data, ll.Lobby, test.lobby)
+		}
+		if test.raw {
+			if ll.String() != test.data {
+				t.Errorf("Parse(%q) = %q, want the line kept as is", test.data, ll.String())
+			}
+		} else if ll.Raw != "" || len(ll.Score) == 0 {
+			t.Errorf("Parse(%q) = %+v", test.data, ll)
+		}
+	}
+}
@@ -5,13 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"compress/gzip"
 	"path/filepath"
-	"unicode/utf8"
 )
 
 type SCxLog struct {
@@ -35,20 +35,23 @@ type SCxLogLine interface {
 type SCALogLine struct {
 	Lobby string
 	StartTime time.Time
-	GameMode string
+	GameMode GameMode
 	Score []UserScore
 }
 
 type SCBLogLine struct {
 	StartTime time.Time
 	Duration string
-	GameMode string
+	GameMode GameMode
 	Score []UserScore
 }
 
 type UserScore struct {
 	UserName string
 	Score float32
+	// Chips is only set in lobbies played with chips
+	Chips *int `json:",omitempty"`
+	Placement int
 }
 
 func parseUserScores(data string, numUsers int) ([]UserScore, error) {
@@ -62,23 +65,71 @@ func parseUserScores(data string, numUsers int) ([]UserScore, error) {
 		scoreIndex := strings.LastIndexByte(field, '(')
 		scores[i].UserName = field[0:scoreIndex]
 
-		var err error
-		var ts float64
-		commaIndex := strings.LastIndexByte(field[scoreIndex + 1:], ',')
-		if commaIndex == -1 {
-			ts, err = strconv.ParseFloat(field[scoreIndex + 1:len(field) - 1], 32)
-		} else {
-			ts, err = strconv.ParseFloat(field[scoreIndex + 1:scoreIndex + commaIndex], 32)
-		}
+		// The score may be followed by chips, +3枚, and by the placement
+		// grep prints, 1位, which is computed again below
+		result := strings.Split(field[scoreIndex + 1:len(field) - 1], ",")
+		ts, err := strconv.ParseFloat(result[0], 32)
 		if err != nil {
 			return scores, err
 		}
+		for _, extra := range result[1:] {
+			switch {
+			case strings.HasSuffix(extra, "枚"):
+				var chips int
+				chips, err = strconv.Atoi(strings.TrimSuffix(extra, "枚"))
+				scores[i].Chips = &chips
+			case strings.HasSuffix(extra, "位"):
+				_, err = strconv.Atoi(strings.TrimSuffix(extra, "位"))
+			default:
+				err = fmt.Errorf("Unexpected %q in score of %s", extra, scores[i].UserName)
+			}
+			if err != nil {
+				return scores, err
+			}
+		}
 		scores[i].Score = float32(ts)
 	}
+	setPlacements(scores)
 
 	return scores, nil
 }
 
+// setPlacements ranks players by score. Tenhou breaks ties by seat order and
+// lists tied players in that order, so ties keep the order of the line.
+func setPlacements(scores []UserScore) {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]].Score > scores[order[b]].Score
+	})
+	for place, i := range order {
+		scores[i].Placement = place + 1
+	}
+}
+
+func writeScores(b *strings.Builder, scores []UserScore) {
+	b.WriteString(" |")
+	for _, s := range scores {
+		b.WriteByte(' ')
+		b.WriteString(s.UserName)
+		b.WriteByte('(')
+		b.WriteString(strconv.FormatFloat(float64(s.Score), 'f', 1, 32))
+		if s.Chips != nil {
+			b.WriteByte(',')
+			if *s.Chips > 0 {
+				b.WriteByte('+')
+			}
+			b.WriteString(strconv.Itoa(*s.Chips))
+			b.WriteString("枚")
+		}
+		b.WriteByte(',')
+		b.WriteString(strconv.Itoa(s.Placement))
+		b.WriteString("位)")
+	}
+}
+
 func (ll *SCALogLine) Parse(data string, date time.Time) error {
 	fields := strings.Split(data, " | ")
 	if len(fields) != 4 {
@@ -87,14 +138,14 @@ func (ll *SCALogLine) Parse(data string, date time.Time) error {
 
 	var err error
 	ll.Lobby = fields[0]
-	ll.GameMode = fields[2]
+	ll.GameMode = ParseGameMode(fields[2])
 
 	start, err := time.Parse("15:04", fields[1])
 	if err != nil {
 		return err
 	}
 	ll.StartTime = date.Add(time.Hour * time.Duration(start.Hour()) + time.Minute * time.Duration(start.Minute()))
-	ll.Score, err = parseUserScores(fields[3], getNumPlayers(ll.GameMode))
+	ll.Score, err = parseUserScores(fields[3], ll.GameMode.Players)
 
 	return err
 }
@@ -105,15 +156,8 @@ func (ll SCALogLine) String() string {
 	b.WriteString(" | ")
 	b.WriteString(ll.StartTime.Format("15:04"))
 	b.WriteString(" | ")
-	b.WriteString(ll.GameMode)
-	b.WriteString(" |")
-	for _, s := range(ll.Score) {
-		b.WriteByte(' ')
-		b.WriteString(s.UserName)
-		b.WriteByte('(')
-		b.WriteString(strconv.FormatFloat(float64(s.Score), 'f', 1, 32))
-		b.WriteByte(')')
-	}
+	b.WriteString(ll.GameMode.Raw)
+	writeScores(&b, ll.Score)
 	return b.String()
 }
 
@@ -130,14 +174,14 @@ func (ll *SCBLogLine) Parse(data string, date time.Time) error {
 
 	var err error
 	ll.Duration = fields[1]
-	ll.GameMode = fields[2]
+	ll.GameMode = ParseGameMode(fields[2])
 
 	start, err := time.Parse("15:04", fields[0])
 	if err != nil {
 		return err
 	}
 	ll.StartTime = date.Add(time.Hour * time.Duration(start.Hour()) + time.Minute * time.Duration(start.Minute()))
-	ll.Score, err = parseUserScores(fields[3], getNumPlayers(ll.GameMode))
+	ll.Score, err = parseUserScores(fields[3], ll.GameMode.Players)
 
 	return err
 }
@@ -148,15 +192,8 @@ func (ll SCBLogLine) String() string {
 	b.WriteString(" | ")
 	b.WriteString(ll.Duration)
 	b.WriteString(" |")
-	b.WriteString(ll.GameMode)
-	b.WriteString(" |")
-	for _, s := range(ll.Score) {
-		b.WriteByte(' ')
-		b.WriteString(s.UserName)
-		b.WriteByte('(')
-		b.WriteString(strconv.FormatFloat(float64(s.Score), 'f', 1, 32))
-		b.WriteByte(')')
-	}
+	b.WriteString(ll.GameMode.Raw)
+	writeScores(&b, ll.Score)
 	return b.String()
 }
 
@@ -181,6 +218,15 @@ func InitSCxLogParser(path string) (SCxLog, error) {
 	case "scb":
 		s.token = &SCBLogLine{}
 		s.Date, err = time.ParseInLocation("20060102", filepath.Base(path)[3:11], japan)
+	case "scc":
+		s.token = &SCCLogLine{}
+		s.Date, err = time.ParseInLocation("20060102", filepath.Base(path)[3:11], japan)
+	case "scd":
+		s.token = &SCDLogLine{}
+		s.Date, err = time.ParseInLocation("20060102", filepath.Base(path)[3:11], japan)
+	case "sce":
+		s.token = &SCELogLine{}
+		s.Date, err = time.ParseInLocation("20060102", filepath.Base(path)[3:11], japan)
 	default:
 		return s, fmt.Errorf("Log Type %s not yet implemented", scx)
 	}
@@ -225,6 +271,12 @@ func (s *SCxLog) Scan() bool {
 	if (!s.lines.Scan()) {
 		return false
 	}
+	// scc files are HTML fragments and may contain blank lines
+	for strings.TrimSpace(s.lines.Text()) == "" {
+		if (!s.lines.Scan()) {
+			return false
+		}
+	}
 	
 	err := s.token.Parse(s.lines.Text(), s.Date)
 	if err != nil {
@@ -244,13 +296,3 @@ func (s SCxLog) Err() error {
 func (s SCxLog) Token() SCxLogLine {
 	return s.token.Clone()
 }
-
-func getNumPlayers(gameMode string) int {
-	if r, _ := utf8.DecodeRuneInString(gameMode); r == '三' {
-		return 3
-	} else if r == '四' {
-		return 4
-	} else {
-		return -1
-	}
-}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSCALogLineChips(t *testing.T) {
+	japan, _ := time.LoadLocation("Japan")
+	date := time.Date(2019, 01, 01, 00, 00, 00, 00, japan)
+	data := "L1234 | 00:03 | 四般南喰赤 | alice(+23.5,+3枚) bob(+7.0,0枚) carol(-15.0,-1枚) dave(-15.0,-2枚)"
+	want := "L1234 | 00:03 | 四般南喰赤 | alice(23.5,+3枚,1位) bob(7.0,0枚,2位) carol(-15.0,-1枚,3位) dave(-15.0,-2枚,4位)"
+
+	var ll SCALogLine
+	if err := ll.Parse(data, date); err != nil {
+		t.Fatal(err)
+	}
+	if got := ll.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// grep output can be read back in
+	var again SCALogLine
+	if err := again.Parse(ll.String(), date); err != nil {
+		t.Fatal(err)
+	}
+	if got := again.String(); got != want {
+		t.Errorf("String() after parsing it again = %q, want %q", got, want)
+	}
+	if again.Score[0].Chips == nil || *again.Score[0].Chips != 3 || *again.Score[3].Chips != -2 {
+		t.Errorf("Chips not read back from %q", ll.String())
+	}
+}
+
+func TestSetPlacementsTies(t *testing.T) {
+	scores := []UserScore{{UserName: "a", Score: -15}, {UserName: "b", Score: 23.5}, {UserName: "c", Score: -15}, {UserName: "d", Score: 6.5}}
+	setPlacements(scores)
+	for i, want := range []int{3, 1, 4, 2} {
+		if scores[i].Placement != want {
+			t.Errorf("%s placed %d, want %d", scores[i].UserName, scores[i].Placement, want)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package storage
 import (
 	"bufio"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -20,6 +23,8 @@ type TenhouLocalStorage struct {
 	Position int      `json:"oya"`
 	Users    []string `json:"uname"`
 	Sc       string   `json:"sc"`
+	// Seat is the seat given by tw in a viewer URL passed to fetch ids
+	Seat *int `json:"tw,omitempty"`
 }
 
 func (t *TenhouLocalStorage) Scan(src interface{}) error {
@@ -94,97 +99,225 @@ func GetMatches(pathRoot string, scx string) (m Matches, err error) {
 	return
 }
 
-func isComplete(logPath string, partial []string) (bool, error) {
-	cInfo, err := os.Stat(logPath)
-	if err != nil {
-		return false, err
-	} else if !cInfo.Mode().IsRegular() {
-		return false, fmt.Errorf("%s not a regular file, aborting", logPath)
-	}
+// AggregateOptions select which hourly logs AggregateLogs merges and what
+// happens to them afterwards.
+type AggregateOptions struct {
+	// Types are the SCx log types to aggregate, all but sca if empty
+	Types []string
+	// Cutoff is the first day whose hourly logs are left alone
+	Cutoff time.Time
+	// Attic moves hourly logs to <root>/attic/ instead of deleting them
+	Attic bool
+	// DryRun only prints the planned merges and deletions to Plan
+	DryRun bool
+	Plan   io.Writer
+}
 
-	var tSize int64 = 0
-	for _, partialLog := range partial {
-		pInfo, err := os.Stat(partialLog)
-		if err != nil {
-			return false, err
-		} else if !pInfo.Mode().IsRegular() {
-			return false, fmt.Errorf("%s not a regular file, aborting", partialLog)
-		}
-		tSize += pInfo.Size()
-	}
-	cSize := cInfo.Size()
-	if tSize * 95 / 100 <= cSize && cSize <= tSize * 105 / 100 {
-		return true, nil
+var aggregateTypes = []string{"scb", "scc", "scd", "sce"}
+
+func (a LogArchive) relPath(path string) string {
+	rel, err := filepath.Rel(a.PathRoot, path)
+	if err != nil {
+		return path
 	}
-	return false, nil
+	return rel
 }
 
-func aggregateSlice(pathRoot, scx string, slice []string, date time.Time) error {
+func (a LogArchive) aggregateSlice(scx string, slice []string, date time.Time, opts AggregateOptions) error {
 	var fName string
 	if strings.Compare(scx, "scc") == 0 {
 		fName = fmt.Sprintf("scc%s.html.gz", date.Format("20060102"))
 	} else {
 		fName = fmt.Sprintf("%s%s.log.gz", scx, date.Format("20060102"))
 	}
-	logPath := filepath.Join(pathRoot, scx, date.Format("2006"), date.Format("01"), fName)
+	logPath := filepath.Join(a.PathRoot, scx, date.Format("2006"), date.Format("01"), fName)
+
+	if opts.DryRun {
+		for _, partialLog := range slice {
+			fmt.Fprintf(opts.Plan, "merge %s -> %s\n", a.relPath(partialLog), a.relPath(logPath))
+		}
+		for _, partialLog := range slice {
+			if opts.Attic {
+				fmt.Fprintf(opts.Plan, "move %s -> %s\n", a.relPath(partialLog), a.relPath(a.atticPath(partialLog)))
+			} else {
+				fmt.Fprintf(opts.Plan, "delete %s\n", a.relPath(partialLog))
+			}
+		}
+		return nil
+	}
 
-	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
-	if os.IsExist(err) {
-		var complete bool
-		complete, err = isComplete(logPath, slice)
+	// A daily log left by an earlier run or fetched from the old list is
+	// merged with the parts instead of being trusted as complete
+	inputs := slice
+	if info, err := os.Stat(logPath); err == nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s not a regular file, aborting", logPath)
+		}
+		inputs = append([]string{logPath}, slice...)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	rec := AggregationRecord{File: filepath.Join(scx, date.Format("2006"), date.Format("01"), fName)}
+	seen := make(map[string]bool)
+	var lines []string
+	for _, input := range inputs {
+		inLines, _, err := readLogLines(input)
 		if err != nil {
 			return err
-		} else if !complete {
-			err = os.Remove(logPath)
-			if err == nil {
-				file, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
-			}
-		} else {
-			for _, partialLog := range slice {
-				os.Remove(partialLog)
+		}
+		rec.Parts = append(rec.Parts, filepath.Base(input))
+		rec.PartLines += len(inLines)
+		for _, line := range inLines {
+			// Hourly files overlap, so the same game can be listed twice
+			if !seen[lineContent(line)] {
+				seen[lineContent(line)] = true
+				lines = append(lines, line)
 			}
-			return nil
 		}
 	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lineTime(lines[i]) < lineTime(lines[j])
+	})
+
+	file, err := createAtomic(logPath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	gzLog, _ := gzip.NewWriterLevel(file, gzip.BestCompression)
-	wrLog := bufio.NewWriter(gzLog)
+	rec.SHA256, err = writeLines(file, lines)
+	if err == nil {
+		err = verifyLines(file, logPath, inputs, rec.SHA256)
+	}
+	if err != nil {
+		file.Abort()
+		return err
+	}
+	if err = file.Commit(); err != nil {
+		return err
+	}
 
+	rec.Lines = len(lines)
+	rec.Time = time.Now()
+	if err = a.addAggregationRecord(rec); err != nil {
+		return err
+	}
+
+	// Partial logs are only removed once the aggregate is verified and
+	// safely on disk
 	for _, partialLog := range slice {
-		logFile, err := os.Open(partialLog)
+		if opts.Attic {
+			err = a.moveToAttic(partialLog)
+		} else {
+			err = os.Remove(partialLog)
+		}
 		if err != nil {
 			return err
 		}
-		defer logFile.Close()
+	}
+	return nil
+}
 
-		reader, err := gzip.NewReader(logFile)
-		if err != nil {
-			return fmt.Errorf("Corrupt gzip input file: %v (%v)\n", partialLog, err)
-		}
-		_, err = wrLog.ReadFrom(reader)
-		if err != nil {
-			return fmt.Errorf("Could not read from gzip input file: %v (%v)\n", partialLog, err)
+func (a LogArchive) atticPath(path string) string {
+	return filepath.Join(a.PathRoot, "attic", a.relPath(path))
+}
+
+func (a LogArchive) moveToAttic(path string) error {
+	atticPath := a.atticPath(path)
+	err := os.MkdirAll(filepath.Dir(atticPath), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path, atticPath)
+}
+
+// lineTime returns the HH:MM start time of an SCx log line, which comes
+// after the lobby in the logs that have one.
+func lineTime(line string) string {
+	fields := strings.SplitN(strings.TrimSpace(line), " | ", 3)
+	if len(fields) > 1 && isLobby(fields[0]) {
+		fields = fields[1:]
+	}
+	if len(fields[0]) != 5 || fields[0][2] != ':' {
+		return ""
+	}
+	return fields[0]
+}
+
+// writeLines writes lines to w compressed and returns the SHA256 of the
+// uncompressed content.
+func writeLines(w io.Writer, lines []string) (string, error) {
+	gzLog, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+	hash := sha256.New()
+	wrLog := bufio.NewWriter(io.MultiWriter(gzLog, hash))
+
+	for _, line := range lines {
+		if _, err := wrLog.WriteString(line); err != nil {
+			return "", err
 		}
-		err = reader.Close()
-		if err != nil {
-			return err
+		// The last line of a part may not be terminated
+		if !strings.HasSuffix(line, "\n") {
+			if err := wrLog.WriteByte(0x0A); err != nil {
+				return "", err
+			}
 		}
-		os.Remove(partialLog)
 	}
-	if err = wrLog.Flush(); err != nil {
+	if err := wrLog.Flush(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), gzLog.Close()
+}
+
+// verifyLines reads back an aggregate before it replaces anything, and
+// checks it against its inputs read again from disk: every line of every
+// input must be in it exactly once, and nothing else.
+func verifyLines(file *atomicFile, logPath string, inputs []string, sum string) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
-	if err = gzLog.Close(); err != nil {
+	written, wSum, err := readGzipLines(file, logPath)
+	if err != nil {
 		return err
 	}
+	if wSum != sum {
+		return fmt.Errorf("Aggregated %s does not match what was written", logPath)
+	}
+
+	found := make(map[string]bool, len(written))
+	for _, line := range written {
+		if found[lineContent(line)] {
+			return fmt.Errorf("Aggregated %s has duplicate line %q", logPath, lineContent(line))
+		}
+		found[lineContent(line)] = true
+	}
+
+	distinct := make(map[string]bool, len(written))
+	total := 0
+	for _, input := range inputs {
+		inLines, _, err := readLogLines(input)
+		if err != nil {
+			return err
+		}
+		total += len(inLines)
+		for _, line := range inLines {
+			if !found[lineContent(line)] {
+				return fmt.Errorf("Aggregated %s is missing line %q from %s", logPath, lineContent(line), input)
+			}
+			distinct[lineContent(line)] = true
+		}
+	}
+	if len(written) != len(distinct) || len(written) > total {
+		return fmt.Errorf("Aggregated %s has %d lines, but its %d parts have %d lines, %d of them distinct",
+			logPath, len(written), len(inputs), total, len(distinct))
+	}
 	return nil
 }
 
-func (a LogArchive) AggregateLogs(japan *time.Location, cutoff time.Time) error {
-	for _, scx := range []string{"scb", "scc", "scd", "sce"} {
+func (a LogArchive) AggregateLogs(japan *time.Location, opts AggregateOptions) error {
+	types := opts.Types
+	if len(types) == 0 {
+		types = aggregateTypes
+	}
+	for _, scx := range types {
 		matches, err := GetMatches(a.PathRoot, scx)
 		if err != nil {
 			return err
@@ -193,10 +326,10 @@ func (a LogArchive) AggregateLogs(japan *time.Location, cutoff time.Time) error
 			continue
 		}
 
-		for matches.FindNextSlice(cutoff, japan) {
+		for matches.FindNextSlice(opts.Cutoff, japan) {
 			slice, date := matches.GetSlice()
 
-			err = aggregateSlice(a.PathRoot, scx, slice, date)
+			err = a.aggregateSlice(scx, slice, date, opts)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregateSortsByTime(t *testing.T) {
+	japan, _ := time.LoadLocation("Japan")
+	a := LogArchive{PathRoot: t.TempDir()}
+	dir := filepath.Join(a.PathRoot, "scd", "2019", "01")
+	writeTestLog(t, filepath.Join(dir, "scd2019010101.log.gz"),
+		"L1234 | 01:05 | 四般東喰赤 | a(+38.0) b(+9.0) c(-12.0) d(-35.0)\n"+
+			"L5678 | 00:50 | 四般東喰赤 | e(+38.0) f(+9.0) g(-12.0) h(-35.0)\n")
+	writeTestLog(t, filepath.Join(dir, "scd2019010100.log.gz"),
+		"L1234 | 00:30 | 四般東喰赤 | a(+38.0) b(+9.0) c(-12.0) d(-35.0)\r\n"+
+			"L5678 | 00:50 | 四般東喰赤 | e(+38.0) f(+9.0) g(-12.0) h(-35.0)\r\n"+
+			"L1234 | 00:10 | 四般東喰赤 | a(+38.0) b(+9.0) c(-12.0) d(-35.0)\r\n")
+
+	opts := AggregateOptions{Types: []string{"scd"}, Cutoff: time.Date(2019, 01, 02, 00, 00, 00, 00, japan)}
+	if err := a.AggregateLogs(japan, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, _, err := readLogLines(filepath.Join(dir, "scd20190101.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"L1234 | 00:10 | 四般東喰赤 | a(+38.0) b(+9.0) c(-12.0) d(-35.0)\r\n",
+		"L1234 | 00:30 | 四般東喰赤 | a(+38.0) b(+9.0) c(-12.0) d(-35.0)\r\n",
+		"L5678 | 00:50 | 四般東喰赤 | e(+38.0) f(+9.0) g(-12.0) h(-35.0)\r\n",
+		"L1234 | 01:05 | 四般東喰赤 | a(+38.0) b(+9.0) c(-12.0) d(-35.0)\n",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("aggregated lines = %q, want %q", lines, want)
+	}
+
+	if parts, _ := filepath.Glob(filepath.Join(dir, "scd??????????.log.gz")); len(parts) != 0 {
+		t.Errorf("hourly logs left behind: %v", parts)
+	}
+}
@@ -1,21 +1,30 @@
 package storage
 
 import (
+	"fmt"
 	"path/filepath"
 	"os"
+	"strings"
 )
 
 type UserLog struct {
-	file *os.File
+	file *atomicFile
 }
 
 type UserLogInfo struct {
 	LogID  string
 	User string
+	// Dir is where the log is stored relative to the archive root,
+	// user/<User>/xml if empty
+	Dir string
 }
 
 func (ul UserLog) Close() error {
-	return ul.file.Close()
+	return ul.file.Commit()
+}
+
+func (ul UserLog) Abort() error {
+	return ul.file.Abort()
 }
 
 func (ul UserLog) Write(p []byte) (int, error) {
@@ -26,8 +35,89 @@ func (a LogArchive) AddUserLog(info UserLogInfo) (UserLog, error) {
 	var log UserLog
 	var err error
 
-	fPath := filepath.Join(a.PathRoot, "user", info.User, "xml", info.LogID+".xml")
-	log.file, err = wrapOpen(fPath)
+	log.file, err = wrapOpen(a.userLogPath(info))
 
 	return log, err
 }
+
+func (a LogArchive) UserLogExists(info UserLogInfo) (bool, error) {
+	_, err := os.Stat(a.userLogPath(info))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (a LogArchive) OpenUserLog(info UserLogInfo) (*os.File, error) {
+	return os.Open(a.userLogPath(info))
+}
+
+func (a LogArchive) userLogPath(info UserLogInfo) string {
+	if info.Dir != "" {
+		return filepath.Join(a.PathRoot, info.Dir, info.LogID+".xml")
+	}
+	return filepath.Join(a.PathRoot, "user", info.User, "xml", info.LogID+".xml")
+}
+
+func (a LogArchive) GetUserGameLogs(user string, logs chan UserLogInfo, errChan chan error) {
+	defer close(logs)
+
+	matches, err := filepath.Glob(filepath.Join(a.PathRoot, "user", user, "xml", "*.xml"))
+	if err != nil {
+		errChan <- err
+		return
+	}
+
+	for _, logFile := range matches {
+		logs <- UserLogInfo{
+			LogID: strings.TrimSuffix(filepath.Base(logFile), ".xml"),
+			User:  filepath.Base(filepath.Dir(filepath.Dir(logFile))),
+		}
+	}
+}
+
+// GetHououGameLogs sends the houou table games saved by fetch houou.
+func (a LogArchive) GetHououGameLogs(logs chan UserLogInfo, errChan chan error) {
+	defer close(logs)
+
+	matches, err := filepath.Glob(filepath.Join(a.PathRoot, hououGlob, "*.xml"))
+	if err != nil {
+		errChan <- err
+		return
+	}
+	for _, logFile := range matches {
+		logs <- a.hououLogInfo(logFile)
+	}
+}
+
+// hououGlob matches the directories returned by HououDir.
+var hououGlob = filepath.Join("houou", "*", "*")
+
+func (a LogArchive) hououLogInfo(logFile string) UserLogInfo {
+	dir, _ := filepath.Rel(a.PathRoot, filepath.Dir(logFile))
+	return UserLogInfo{LogID: strings.TrimSuffix(filepath.Base(logFile), ".xml"), Dir: dir}
+}
+
+func (a LogArchive) FindUserLog(logID string) (UserLogInfo, error) {
+	logID, err := a.ResolveLogAlias(logID)
+	if err != nil {
+		return UserLogInfo{}, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(a.PathRoot, "user", "*", "xml", logID+".xml"))
+	if err != nil {
+		return UserLogInfo{}, err
+	}
+	if len(matches) > 0 {
+		return UserLogInfo{LogID: logID, User: filepath.Base(filepath.Dir(filepath.Dir(matches[0])))}, nil
+	}
+
+	matches, err = filepath.Glob(filepath.Join(a.PathRoot, hououGlob, logID+".xml"))
+	if err != nil {
+		return UserLogInfo{}, err
+	}
+	if len(matches) > 0 {
+		return a.hououLogInfo(matches[0]), nil
+	}
+	return UserLogInfo{}, fmt.Errorf("No log with ID %s in %s", logID, a.PathRoot)
+}
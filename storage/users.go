@@ -29,16 +29,19 @@ func (us *UserStorage) Read(path string) error {
 }
 
 func (us UserStorage) Write(path string) error {
-	userFile, err := os.Create(path)
+	userFile, err := createAtomic(path)
 	if err != nil {
 		return err
 	}
-	defer userFile.Close()
 
 	enc := json.NewEncoder(userFile)
 	err = enc.Encode(us)
+	if err != nil {
+		userFile.Abort()
+		return err
+	}
 
-	return err
+	return userFile.Commit()
 }
 
 func (us UserStorage) AddUser(user string, aliases []string) error {
@@ -1,19 +1,128 @@
 package storage
 
 import (
-	"path/filepath"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
-func wrapOpen(fPath string) (*os.File, error) {
-	file, err := os.OpenFile(fPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+const tempInfix = ".tmp-"
+
+// atomicFile is written to a temporary file next to path, which only
+// replaces path once Commit has synced it to disk.
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+func createAtomic(fPath string) (*atomicFile, error) {
+	file, err := ioutil.TempFile(filepath.Dir(fPath), "."+filepath.Base(fPath)+tempInfix+"*")
 	if os.IsNotExist(err) {
 		err = os.MkdirAll(filepath.Dir(fPath), 0755)
 		if err != nil {
 			return nil, err
 		}
-		return wrapOpen(fPath)
+		return createAtomic(fPath)
+	} else if err != nil {
+		return nil, err
+	}
+	err = file.Chmod(0644)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &atomicFile{File: file, path: fPath}, nil
+}
+
+func (f *atomicFile) Commit() error {
+	err := f.File.Sync()
+	if err != nil {
+		f.Abort()
+		return err
+	}
+	err = f.File.Close()
+	if err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	err = os.Rename(f.File.Name(), f.path)
+	if err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(f.path))
+}
+
+func (f *atomicFile) Abort() error {
+	f.File.Close()
+	return os.Remove(f.File.Name())
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
 	}
-	return file, err
+	defer d.Close()
+	d.Sync()
+	return nil
 }
 
+// wrapOpen creates fPath for writing, failing like O_EXCL if it already
+// exists. Nothing appears at fPath until the returned file is committed.
+func wrapOpen(fPath string) (*atomicFile, error) {
+	if _, err := os.Lstat(fPath); err == nil {
+		return nil, &os.PathError{Op: "open", Path: fPath, Err: os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return createAtomic(fPath)
+}
+
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempInfix)
+}
+
+// tempFileAge is how long a temporary file has to go unmodified before it is
+// taken to be left behind, rather than still written by another process.
+const tempFileAge = time.Hour
+
+// RemoveTempFiles deletes temporary files left behind by interrupted writes.
+// The archive is only walked once per tempFileAge, as recorded by the
+// modification time of a stamp file in its root.
+func (a LogArchive) RemoveTempFiles() error {
+	if _, err := os.Stat(a.PathRoot); os.IsNotExist(err) {
+		return nil
+	}
+	stamp := filepath.Join(a.PathRoot, ".tempfiles-checked")
+	if info, err := os.Stat(stamp); err == nil && time.Since(info.ModTime()) < tempFileAge {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-tempFileAge)
+	err := filepath.Walk(a.PathRoot, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && isTempFile(info.Name()) && info.ModTime().Before(cutoff) {
+			if err = os.Remove(path); !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(stamp)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,99 @@
+package tenhou
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+)
+
+const mjlogBase string = "http://tenhou.net/3/mjlog2xml.cgi?"
+const referBase string = "http://tenhou.net/3/?log="
+const scrawBase string = "http://tenhou.net/sc/raw"
+
+// Endpoints are the URLs logs are fetched from. MJLog and Refer are
+// prefixes the log ID is appended to, SCRAW is the directory holding
+// list.cgi, dat/ and the yearly scraw zips.
+type Endpoints struct {
+	MJLog string `json:"mjlog,omitempty"`
+	Refer string `json:"refer,omitempty"`
+	SCRAW string `json:"scraw,omitempty"`
+}
+
+func DefaultEndpoints() Endpoints {
+	return Endpoints{MJLog: mjlogBase, Refer: referBase, SCRAW: scrawBase}
+}
+
+// LoadEndpoints returns the default endpoints overridden by the JSON config
+// file at configFile, if not empty, and then by the GTENLOG_*_URL
+// environment variables.
+func LoadEndpoints(configFile string) (Endpoints, error) {
+	e := DefaultEndpoints()
+
+	if configFile != "" {
+		file, err := os.Open(configFile)
+		if err != nil {
+			return e, err
+		}
+		defer file.Close()
+
+		var config Endpoints
+		if err = json.NewDecoder(file).Decode(&config); err != nil {
+			return e, fmt.Errorf("Invalid endpoint config %s: %s", configFile, err)
+		}
+		e = e.Override(config)
+	}
+
+	return e.Override(Endpoints{
+		MJLog: os.Getenv("GTENLOG_MJLOG_URL"),
+		Refer: os.Getenv("GTENLOG_REFER_URL"),
+		SCRAW: os.Getenv("GTENLOG_SCRAW_URL"),
+	}), nil
+}
+
+// Override replaces every endpoint that is set in o.
+func (e Endpoints) Override(o Endpoints) Endpoints {
+	if o.MJLog != "" {
+		e.MJLog = o.MJLog
+	}
+	if o.Refer != "" {
+		e.Refer = o.Refer
+	}
+	if o.SCRAW != "" {
+		e.SCRAW = o.SCRAW
+	}
+	return e
+}
+
+func (e Endpoints) Validate() error {
+	for name, endpoint := range map[string]string{"mjlog": e.MJLog, "refer": e.Refer, "scraw": e.SCRAW} {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return fmt.Errorf("Invalid %s endpoint %q: %s", name, endpoint, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid %s endpoint %q: must be an http or https URL", name, endpoint)
+		}
+	}
+	return nil
+}
+
+func (e Endpoints) withDefaults() Endpoints {
+	return DefaultEndpoints().Override(e)
+}
+
+func (e Endpoints) mjlogURL(logID string) string {
+	return e.withDefaults().MJLog + logID
+}
+
+func (e Endpoints) referURL(logID string) string {
+	return e.withDefaults().Refer + logID
+}
+
+// scrawURL returns the URL of elem below the SCRAW endpoint.
+func (e Endpoints) scrawURL(elem ...string) *url.URL {
+	u, _ := url.Parse(e.withDefaults().SCRAW)
+	u.Path = path.Join(append([]string{u.Path}, elem...)...)
+	return u
+}
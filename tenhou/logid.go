@@ -0,0 +1,169 @@
+package tenhou
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-14/gtenlog/mjlog"
+)
+
+// LogID is a decoded game log ID such as 2019052113gm-0089-0000-8f2a7c1d.
+type LogID struct {
+	ID    string
+	Start time.Time
+	Type  mjlog.GameType
+	Lobby int
+	Hash  string
+}
+
+func ParseLogID(id string) (LogID, error) {
+	l := LogID{ID: id}
+
+	fields := strings.Split(id, "-")
+	if len(fields) != 4 || len(fields[0]) != 12 || fields[0][10:] != "gm" {
+		return l, fmt.Errorf("Invalid log ID %s", id)
+	}
+
+	japan, err := time.LoadLocation("Japan")
+	if err != nil {
+		return l, err
+	}
+	l.Start, err = time.ParseInLocation("2006010215", fields[0][:10], japan)
+	if err != nil {
+		return l, fmt.Errorf("Invalid log ID %s: %s", id, err)
+	}
+
+	gameType, err := strconv.ParseUint(fields[1], 16, 16)
+	if err != nil {
+		return l, fmt.Errorf("Invalid game type in log ID %s: %s", id, err)
+	}
+	l.Type = mjlog.GameType(gameType)
+
+	l.Lobby, err = strconv.Atoi(fields[2])
+	if err != nil {
+		return l, fmt.Errorf("Invalid lobby in log ID %s: %s", id, err)
+	}
+
+	l.Hash = fields[3]
+	return l, nil
+}
+
+func (l LogID) String() string {
+	return l.ID
+}
+
+func (l LogID) Date() time.Time {
+	return time.Date(l.Start.Year(), l.Start.Month(), l.Start.Day(), 00, 00, 00, 00, l.Start.Location())
+}
+
+func (l LogID) RuleName() string {
+	return l.Type.Name()
+}
+
+func (l LogID) LobbyName() string {
+	return fmt.Sprintf("L%04d", l.Lobby)
+}
+
+// MatchesRule reports whether the game was played under rule, given either as
+// a Tenhou rule string (四鳳南喰赤) or as a readable rule name.
+func (l LogID) MatchesRule(rule string) bool {
+	return rule == l.Type.String() || strings.EqualFold(rule, l.Type.Name())
+}
+
+// ValidRule reports whether rule is matched by the log IDs of any game type.
+func ValidRule(rule string) bool {
+	for t := 0; t <= 0xff; t++ {
+		if (LogID{Type: mjlog.GameType(t)}).MatchesRule(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+var logIDKeys = []uint16{
+	22136, 52719, 55146, 42104, 59591, 46934, 9248, 28891,
+	49597, 52974, 62844, 4015, 18311, 50730, 43056, 17939,
+	64838, 38145, 27008, 39128, 35652, 63407, 65535, 23473,
+	35164, 55230, 27536, 4386, 64920, 29075, 42617, 17294,
+	18868, 2081,
+}
+
+// Obfuscated reports whether the ID comes from the Tenhou client's share
+// feature, whose hash is an x followed by 12 hex digits.
+func (l LogID) Obfuscated() bool {
+	return strings.HasPrefix(l.Hash, "x")
+}
+
+// Canonical returns the ID the game is stored under on tenhou.net.
+func (l LogID) Canonical() (LogID, error) {
+	if !l.Obfuscated() {
+		return l, nil
+	}
+	if len(l.Hash) != 13 {
+		return l, fmt.Errorf("Invalid obfuscated log ID %s", l.ID)
+	}
+
+	var parts [3]uint16
+	for i := range parts {
+		n, err := strconv.ParseUint(l.Hash[1+i*4:5+i*4], 16, 16)
+		if err != nil {
+			return l, fmt.Errorf("Invalid obfuscated log ID %s: %s", l.ID, err)
+		}
+		parts[i] = uint16(n)
+	}
+
+	index := 0
+	if l.ID[:12] >= "2010041111gm" {
+		x, _ := strconv.Atoi("3" + l.ID[4:10])
+		y := int(l.ID[9] - '0')
+		index = x % (33 - y)
+	}
+	first := parts[0] ^ parts[1] ^ logIDKeys[index]
+	second := parts[1] ^ parts[2] ^ logIDKeys[index] ^ logIDKeys[index+1]
+
+	c := l
+	c.Hash = fmt.Sprintf("%04x%04x", first, second)
+	c.ID = l.ID[:strings.LastIndexByte(l.ID, '-')+1] + c.Hash
+	return c, nil
+}
+
+func CanonicalLogID(id string) (string, error) {
+	l, err := ParseLogID(id)
+	if err != nil {
+		return id, err
+	}
+	c, err := l.Canonical()
+	return c.ID, err
+}
+
+// ParseLogRef accepts either a bare log ID or a tenhou.net viewer URL such as
+// https://tenhou.net/0/?log=<id>&tw=2 and returns the log ID and the seat
+// given by tw, or -1 if there is none.
+func ParseLogRef(ref string) (string, int, error) {
+	if !strings.Contains(ref, "log=") {
+		_, err := ParseLogID(ref)
+		return ref, -1, err
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", -1, err
+	}
+	query := u.Query()
+	id := query.Get("log")
+	if _, err = ParseLogID(id); err != nil {
+		return "", -1, err
+	}
+
+	seat := -1
+	if tw := query.Get("tw"); tw != "" {
+		seat, err = strconv.Atoi(tw)
+		if err != nil || seat < 0 || seat > 3 {
+			return "", -1, fmt.Errorf("Invalid seat %s in %s", tw, ref)
+		}
+	}
+	return id, seat, nil
+}
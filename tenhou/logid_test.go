@@ -0,0 +1,41 @@
+package tenhou
+
+import "testing"
+
+func TestCanonicalLogID(t *testing.T) {
+	tests := []struct {
+		id        string
+		canonical string
+	}{
+		{"2010041110gm-00a9-0000-x456f1234226e", "2010041110gm-00a9-0000-0123abcd"},
+		{"2010041111gm-00a9-0000-x48a612346b14", "2010041111gm-00a9-0000-0123abcd"},
+		{"2019052113gm-00a9-0000-xb76f1234f546", "2019052113gm-00a9-0000-0123abcd"},
+		{"2019052113gm-00a9-0000-0123abcd", "2019052113gm-00a9-0000-0123abcd"},
+	}
+	for _, test := range tests {
+		canonical, err := CanonicalLogID(test.id)
+		if err != nil {
+			t.Errorf("CanonicalLogID(%s): %s", test.id, err)
+		} else if canonical != test.canonical {
+			t.Errorf("CanonicalLogID(%s) = %s, want %s", test.id, canonical, test.canonical)
+		}
+	}
+}
+
+func TestValidRule(t *testing.T) {
+	tests := []struct {
+		rule  string
+		valid bool
+	}{
+		{"四鳳南喰赤", true},
+		{"Houou Yonma Hanchan Kuitan Aka", true},
+		{"houou yonma hanchan kuitan aka", true},
+		{"四鳳南喰赤x", false},
+		{"bogus", false},
+	}
+	for _, test := range tests {
+		if valid := ValidRule(test.rule); valid != test.valid {
+			t.Errorf("ValidRule(%q) = %v, want %v", test.rule, valid, test.valid)
+		}
+	}
+}
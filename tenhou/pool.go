@@ -0,0 +1,109 @@
+package tenhou
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a request may be made. Tokens may go negative, which
+// reserves a slot in the future for the caller.
+func (l *rateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+type rateLimitedTransport struct {
+	limiter *rateLimiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.limiter.Wait()
+	return t.next.RoundTrip(req)
+}
+
+type workerPool struct {
+	jobs   chan func() error
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	err    error
+	failed bool
+}
+
+func newWorkerPool(workers int) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &workerPool{jobs: make(chan func() error)}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		if p.hasFailed() {
+			continue
+		}
+		if err := job(); err != nil {
+			p.mu.Lock()
+			if !p.failed {
+				p.err = err
+				p.failed = true
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *workerPool) hasFailed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.failed
+}
+
+// Submit queues a job, returning false once any job has failed.
+func (p *workerPool) Submit(job func() error) bool {
+	if p.hasFailed() {
+		return false
+	}
+	p.jobs <- job
+	return true
+}
+
+// Wait waits for all queued jobs and returns the first error.
+func (p *workerPool) Wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+	return p.err
+}
@@ -0,0 +1,191 @@
+package tenhou
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// Recordings are stored as one file per response, named after the request
+// so that a single response such as list.cgi is easy to find and share.
+// Repeated requests, for example retries, are numbered in the order they
+// were made and replayed in the same order.
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9.\-]+`)
+
+// recordingKey identifies a request by everything that changes the response
+// we get back.
+func recordingKey(req *http.Request) string {
+	key := req.Method + " " + req.URL.String()
+	if r := req.Header.Get("Range"); r != "" {
+		key += " Range: " + r + " If-Range: " + req.Header.Get("If-Range")
+	}
+	name := unsafeName.ReplaceAllString(req.Method+"_"+req.URL.Host+req.URL.RequestURI(), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	sum := sha1.Sum([]byte(key))
+	return fmt.Sprintf("%s-%x", name, sum[:4])
+}
+
+func recordingPath(dir, key string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%03d.http", key, n))
+}
+
+// recordingTransport saves every response it receives from next under dir.
+type recordingTransport struct {
+	dir  string
+	next http.RoundTripper
+
+	mu    sync.Mutex
+	count map[string]int
+}
+
+func newRecordingTransport(dir string, next http.RoundTripper) *recordingTransport {
+	return &recordingTransport{dir: dir, next: next, count: make(map[string]int)}
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	// Dump the headers as a plain response. A body of unknown length is
+	// read back until the end of the file. HEAD responses keep their
+	// Content-Length without a body.
+	saved := *resp
+	saved.TransferEncoding = nil
+	if req.Method != "HEAD" && resp.ContentLength < 0 {
+		saved.Close = true
+	}
+	header, err := httputil.DumpResponse(&saved, false)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	key := recordingKey(req)
+	t.mu.Lock()
+	t.count[key]++
+	n := t.count[key]
+	t.mu.Unlock()
+
+	if err = os.MkdirAll(t.dir, 0755); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	file, err := os.Create(recordingPath(t.dir, key, n))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if _, err = file.Write(header); err != nil {
+		file.Close()
+		resp.Body.Close()
+		return nil, err
+	}
+	if req.Method == "HEAD" {
+		return resp, file.Close()
+	}
+
+	// The body is written to the recording as it is read, so that large
+	// downloads are never held in memory
+	resp.Body = &recordingBody{Reader: io.TeeReader(resp.Body, file), body: resp.Body, file: file}
+	return resp, nil
+}
+
+type recordingBody struct {
+	io.Reader
+	body io.ReadCloser
+	file *os.File
+	err  error
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// Close records whatever is left of the body, so that a response closed
+// early, such as an error page, is still saved in full.
+func (b *recordingBody) Close() error {
+	if b.err == nil {
+		io.Copy(ioutil.Discard, b.Reader)
+	}
+	err := b.body.Close()
+	if fErr := b.file.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
+
+// replayTransport serves responses saved by recordingTransport without
+// touching the network. Once the recorded responses for a request run out,
+// the last one is served again.
+type replayTransport struct {
+	dir string
+
+	mu    sync.Mutex
+	count map[string]int
+}
+
+func newReplayTransport(dir string) *replayTransport {
+	return &replayTransport{dir: dir, count: make(map[string]int)}
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := recordingKey(req)
+
+	t.mu.Lock()
+	n := t.count[key] + 1
+	if _, err := os.Stat(recordingPath(t.dir, key, n)); err == nil {
+		t.count[key] = n
+	} else {
+		n = t.count[key]
+	}
+	t.mu.Unlock()
+
+	if n == 0 {
+		return nil, fmt.Errorf("No recorded response for %s %s in %s", req.Method, req.URL, t.dir)
+	}
+	file, err := os.Open(recordingPath(t.dir, key, n))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(file), req)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	resp.Body = replayBody{ReadCloser: resp.Body, file: file}
+	return resp, nil
+}
+
+// replayBody closes the recording along with the body read from it.
+type replayBody struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (b replayBody) Close() error {
+	err := b.ReadCloser.Close()
+	if fErr := b.file.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package tenhou
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const maxBackoff = time.Minute
+
+var errTruncated = errors.New("Response body is truncated")
+
+var errDayNotFound = errors.New("No logs in the current list, the old list or the SCRAW zip")
+
+type httpError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%s request for %s failed: %s", e.Method, e.URL, http.StatusText(e.StatusCode))
+}
+
+func newHTTPError(req *http.Request, resp *http.Response) *httpError {
+	e := &httpError{Method: req.Method, URL: req.URL.String(), StatusCode: resp.StatusCode}
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		} else if t, err := http.ParseTime(ra); err == nil {
+			e.RetryAfter = time.Until(t)
+		}
+	}
+	return e
+}
+
+func isTransient(err error) bool {
+	var he *httpError
+	if errors.As(err, &he) {
+		return he.StatusCode >= 500 || he.StatusCode == http.StatusTooManyRequests
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, errTruncated) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum)
+}
+
+func backoff(attempt int, err error) time.Duration {
+	var he *httpError
+	if errors.As(err, &he) && he.RetryAfter > 0 {
+		return he.RetryAfter
+	}
+	d := time.Second << uint(attempt)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// withRetry runs fn until it succeeds, fails permanently or has been retried
+// retries times.
+func withRetry(retries int, fn func() (bool, error)) (bool, error) {
+	for attempt := 0; ; attempt++ {
+		skipped, err := fn()
+		if err == nil || attempt >= retries || !isTransient(err) {
+			if err != nil && attempt > 0 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return skipped, err
+		}
+		time.Sleep(backoff(attempt, err))
+	}
+}
+
+type FetchFailure struct {
+	Item      string
+	Err       error
+	Transient bool
+}
+
+type FetchSummary struct {
+	mu        sync.Mutex
+	Succeeded int
+	Skipped   int
+	Failed    []FetchFailure
+}
+
+func (s *FetchSummary) record(item string, skipped bool, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case err != nil:
+		s.Failed = append(s.Failed, FetchFailure{Item: item, Err: err, Transient: isTransient(err)})
+	case skipped:
+		s.Skipped++
+	default:
+		s.Succeeded++
+	}
+}
+
+func (s *FetchSummary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%d fetched, %d skipped, %d failed", s.Succeeded, s.Skipped, len(s.Failed))
+}
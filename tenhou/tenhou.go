@@ -2,159 +2,440 @@ package tenhou
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	s "github.com/c-14/gtenlog/storage"
 	"io"
+	"io/ioutil"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-const mjlogBase string = "http://tenhou.net/3/mjlog2xml.cgi?"
-const referBase string = "http://tenhou.net/3/?log="
-const scrawBase string = "http://tenhou.net/sc/raw"
+type HTTPOptions struct {
+	// Rate is the number of requests per second allowed across all
+	// workers, 0 for no limit.
+	Rate  float64
+	Burst int
+	// Record saves every response under this directory, while Replay
+	// serves responses saved there instead of using the network.
+	Record string
+	Replay string
+}
 
-func SetupHTTP() *http.Client {
-	return &http.Client{}
+type FetchOptions struct {
+	Workers int
+	// Retries is how often a download that failed with a transient error
+	// is attempted again.
+	Retries int
+	Summary *FetchSummary
+	// Ledger records failed downloads, and downloads that failed
+	// permanently before are skipped.
+	Ledger *s.FailureLedger
+	// Endpoints overrides where logs are fetched from, empty fields use
+	// tenhou.net.
+	Endpoints Endpoints
 }
 
-func FetchGameLogs(conn *http.Client, archive s.LogArchive, logs chan s.UserLogInfo, errChan chan error, done chan int) {
-	defer func() { done <- 1 }()
-	for log := range logs {
-		ul, err := archive.AddUserLog(log)
-		if os.IsExist(err) {
-			continue
-		}
-		defer ul.Close()
+func (opts FetchOptions) record(f s.FailedFetch, skipped bool, err error) {
+	opts.Summary.record(f.Item, skipped, err)
+	if opts.Ledger == nil {
+		return
+	}
+	if err != nil {
+		f.Error = err.Error()
+		f.Permanent = !isTransient(err)
+		f.Time = time.Now()
+		opts.Ledger.Record(f)
+	} else {
+		opts.Ledger.Clear(f)
+	}
+}
 
-		req, err := http.NewRequest("GET", mjlogBase+log.LogID, nil)
-		if err != nil {
-			errChan <- err
-			return
-		}
-		req.Header.Add("Referer", referBase+log.LogID)
-		resp, err := conn.Do(req)
+func (opts FetchOptions) knownFailure(f s.FailedFetch) bool {
+	if opts.Ledger == nil || !opts.Ledger.IsPermanent(f) {
+		return false
+	}
+	opts.Summary.record(f.Item, true, nil)
+	return true
+}
+
+func SetupHTTP(opts HTTPOptions) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if opts.Replay != "" {
+		return &http.Client{Transport: newReplayTransport(opts.Replay)}
+	}
+	if opts.Record != "" {
+		transport = newRecordingTransport(opts.Record, transport)
+	}
+	if opts.Rate > 0 {
+		transport = &rateLimitedTransport{limiter: newRateLimiter(opts.Rate, opts.Burst), next: transport}
+	}
+	return &http.Client{Transport: transport}
+}
+
+func fetchGameLog(conn *http.Client, endpoints Endpoints, archive s.LogArchive, log s.UserLogInfo) (bool, error) {
+	// IDs that don't decode are fetched as they are
+	logID, err := CanonicalLogID(log.LogID)
+	if err == nil && logID != log.LogID {
+		err = archive.AddLogAlias(log.LogID, logID)
 		if err != nil {
-			errChan <- err
-			return
+			return false, err
 		}
-		defer resp.Body.Close()
+		log.LogID = logID
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			errChan <- fmt.Errorf("GET request for %s failed: %s", mjlogBase+log.LogID, http.StatusText(resp.StatusCode))
-			return
-		}
+	if exists, err := archive.UserLogExists(log); err != nil || exists {
+		return exists, err
+	}
 
-		wrLog := bufio.NewWriter(ul)
-		_, err = wrLog.ReadFrom(resp.Body)
-		if err != nil {
-			errChan <- err
-			return
+	req, err := http.NewRequest("GET", endpoints.mjlogURL(log.LogID), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Add("Referer", endpoints.referURL(log.LogID))
+	resp, err := conn.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, newHTTPError(req, resp)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.HasSuffix(bytes.TrimSpace(body), []byte("</mjloggm>")) {
+		return false, errTruncated
+	}
+
+	ul, err := archive.AddUserLog(log)
+	if os.IsExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = ul.Write(body)
+	if err != nil {
+		ul.Abort()
+		return false, err
+	}
+	return false, ul.Close()
+}
+
+func FetchGameLogs(conn *http.Client, archive s.LogArchive, opts FetchOptions, logs chan s.UserLogInfo, errChan chan error, done chan int) {
+	defer func() { done <- 1 }()
+
+	pool := newWorkerPool(opts.Workers)
+	for log := range logs {
+		log := log
+		f := s.FailedFetch{Kind: s.FailedUserLog, Item: log.LogID, User: log.User, Dir: log.Dir}
+		if opts.knownFailure(f) {
+			continue
 		}
-		err = wrLog.Flush()
-		if err != nil {
-			errChan <- err
-			return
+		ok := pool.Submit(func() error {
+			skipped, err := withRetry(opts.Retries, func() (bool, error) {
+				return fetchGameLog(conn, opts.Endpoints, archive, log)
+			})
+			opts.record(f, skipped, err)
+			return nil
+		})
+		if !ok {
+			break
 		}
 	}
+	if err := pool.Wait(); err != nil {
+		errChan <- err
+	}
 }
 
-func fetchArchivedLog(conn *http.Client, logInfo s.LogInfo, logURL string) error {
+func fetchArchivedLog(conn *http.Client, logInfo s.LogInfo, logURL string) (bool, error) {
 	exists, err := logInfo.Exists()
 	if exists {
 		// File exists, check that length matches remote
-		resp, err := conn.Head(logURL)
+		req, _ := http.NewRequest("HEAD", logURL, nil)
+		resp, err := conn.Do(req)
 		if err != nil {
-			return err
+			return false, err
 		}
+		resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("HEAD request for %s failed: %s", logURL, http.StatusText(resp.StatusCode))
+			return false, newHTTPError(req, resp)
 		}
 		rLength := resp.ContentLength
 
 		if logInfo.IsComplete(rLength) {
-			return nil
+			return true, nil
 		}
 
 		err = logInfo.Remove()
 		if err != nil {
-			return err
+			return false, err
 		}
 	} else if err != nil {
-		return err
+		return false, err
+	}
+
+	if !strings.HasSuffix(logURL, ".gz") {
+		return false, fetchResumable(conn, logInfo, logURL)
 	}
 
 	// File does not exist yet, so download
-	resp, err := conn.Get(logURL)
+	req, _ := http.NewRequest("GET", logURL, nil)
+	resp, err := conn.Do(req)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("GET request for %s failed: %s", logURL, http.StatusText(resp.StatusCode))
+		return false, newHTTPError(req, resp)
+	}
+
+	// gzip files are small, verify them completely before writing
+	b, err := verifiedGzip(resp.Body)
+	if err != nil {
+		return false, err
 	}
 
 	err = logInfo.Open()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = logInfo.Write(b)
+	if err != nil {
+		logInfo.Abort()
+		return false, err
+	}
+	return false, logInfo.Close()
+}
+
+// fetchResumable downloads logURL into a partial file, continuing from an
+// earlier interrupted download with a Range request when the server still
+// serves the same content. The partial file is kept on failure so that the
+// next attempt can resume it.
+func fetchResumable(conn *http.Client, logInfo s.LogInfo, logURL string) error {
+	partial, resume, err := logInfo.Partial()
+	if err != nil {
+		return err
+	}
+	if resume && (partial.Size == 0 || partial.Validator() == "") {
+		resume = false
+	}
+
+	req, _ := http.NewRequest("GET", logURL, nil)
+	if resume {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", partial.Size))
+		req.Header.Set("If-Range", partial.Validator())
+	}
+	resp, err := conn.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var offset int64
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && resume:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != partial.Size || (partial.Length > 0 && total > 0 && total != partial.Length) {
+			logInfo.RemovePartial()
+			return fmt.Errorf("Unexpected Content-Range %q for %s", resp.Header.Get("Content-Range"), logURL)
+		}
+		offset = partial.Size
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && resume:
+		// Partial is already as long as the remote file, or the remote
+		// file shrank. Either way start over.
+		resp.Body.Close()
+		if err = logInfo.RemovePartial(); err != nil {
+			return err
+		}
+		return fetchResumable(conn, logInfo, logURL)
+	case resp.StatusCode == http.StatusOK:
+		// Server ignored the range or the file changed, start from scratch
+		partial = s.PartialDownload{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Length:       resp.ContentLength,
+		}
+	default:
+		return newHTTPError(req, resp)
+	}
+
+	err = logInfo.OpenPartial(partial, offset)
 	if err != nil {
 		return err
 	}
-	defer logInfo.Close()
 
 	wrLog := bufio.NewWriter(logInfo)
-	_, err = wrLog.ReadFrom(resp.Body)
+	n, err := wrLog.ReadFrom(resp.Body)
+	if err == nil {
+		err = wrLog.Flush()
+	}
+	if err == nil && partial.Length > 0 && offset+n != partial.Length {
+		err = errTruncated
+	}
 	if err != nil {
+		logInfo.Abort()
 		return err
 	}
-	return wrLog.Flush()
+	return logInfo.Close()
+}
+
+// parseContentRange parses a "bytes start-end/total" header. total is -1
+// if the server does not know the complete length.
+func parseContentRange(cr string) (start, total int64, ok bool) {
+	var end int64
+	var size string
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return 0, 0, false
+	}
+	if size == "*" {
+		return start, -1, true
+	}
+	total, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+func verifiedGzip(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return b, err
+	}
+	gzLog, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return b, err
+	}
+	_, err = io.Copy(ioutil.Discard, gzLog)
+	return b, err
+}
+
+func fetchArchivedLogWithRetry(conn *http.Client, opts FetchOptions, logInfo s.LogInfo, logURL string) (bool, error) {
+	return withRetry(opts.Retries, func() (bool, error) {
+		return fetchArchivedLog(conn, logInfo, logURL)
+	})
+}
+
+var scrawLocks = struct {
+	sync.Mutex
+	years map[int]*sync.Mutex
+}{years: make(map[int]*sync.Mutex)}
+
+// lockSCRAWYear keeps fetch all from downloading and unpacking the same zip
+// from FetchSCx and FetchSCRAW at once.
+func lockSCRAWYear(year int) *sync.Mutex {
+	scrawLocks.Lock()
+	defer scrawLocks.Unlock()
+	l, ok := scrawLocks.years[year]
+	if !ok {
+		l = &sync.Mutex{}
+		scrawLocks.years[year] = l
+	}
+	l.Lock()
+	return l
 }
 
-func FetchSCRAW(conn *http.Client, archive s.LogArchive, errChan chan error, done chan int) {
+// fetchSCRAWYear downloads the SCRAW zip for year and unpacks the daily logs
+// between start and end from it.
+func fetchSCRAWYear(conn *http.Client, archive s.LogArchive, opts FetchOptions, year int, start, end time.Time) (bool, error) {
+	defer lockSCRAWYear(year).Unlock()
+
+	name := fmt.Sprintf("scraw%d.zip", year)
+	logInfo := archive.AddSCRAWLogInfo(year)
+	skipped, err := fetchArchivedLogWithRetry(conn, opts, &logInfo, opts.Endpoints.scrawURL(name).String())
+	if err != nil {
+		return skipped, err
+	}
+	n, err := archive.UnpackSCRAW(year, start, end)
+	if err != nil {
+		return false, fmt.Errorf("Failed to unpack %s: %s", name, err)
+	}
+	return skipped && n == 0, nil
+}
+
+func FetchSCRAW(conn *http.Client, archive s.LogArchive, opts FetchOptions, errChan chan error, done chan int) {
 	defer func() { done <- 1 }()
 
 	japan, _ := time.LoadLocation("Japan")
 	currentYear := time.Now().In(japan).Year()
+	pool := newWorkerPool(opts.Workers)
 	for year := 2006; year < currentYear; year++ {
-		logURL, _ := url.Parse(scrawBase)
-		logURL.Path = path.Join(logURL.Path, fmt.Sprintf("scraw%d.zip", year))
-		logInfo := archive.AddSCRAWLogInfo(year)
+		year := year
+		f := s.FailedFetch{Kind: s.FailedSCRAW, Item: fmt.Sprintf("scraw%d.zip", year)}
+		if opts.knownFailure(f) {
+			continue
+		}
 
-		err := fetchArchivedLog(conn, &logInfo, logURL.String())
-		if err != nil {
-			if year < currentYear - 1 {
-				errChan <- err
-				return
+		ok := pool.Submit(func() error {
+			skipped, err := fetchSCRAWYear(conn, archive, opts, year, time.Time{}, time.Time{})
+			if err != nil && year >= currentYear-1 {
+				// Last year's archive may not have been published yet
+				skipped, err = true, nil
 			}
+			opts.record(f, skipped, err)
+			return nil
+		})
+		if !ok {
+			break
 		}
 	}
+	if err := pool.Wait(); err != nil {
+		errChan <- err
+	}
 }
 
-func getLogList(conn *http.Client, old bool, logList *io.ReadCloser) error {
-	listURL, _ := url.Parse(scrawBase)
-	listURL.Path = path.Join(listURL.Path, "list.cgi")
+func getLogList(conn *http.Client, opts FetchOptions, old bool, logList *io.ReadCloser) error {
+	listURL := opts.Endpoints.scrawURL("list.cgi")
 	if old {
 		listURL.RawQuery = "old"
 	}
 
-	resp, err := conn.Get(listURL.String())
-	if err != nil {
-		return err
-	}
+	_, err := withRetry(opts.Retries, func() (bool, error) {
+		req, _ := http.NewRequest("GET", listURL.String(), nil)
+		resp, err := conn.Do(req)
+		if err != nil {
+			return false, err
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return fmt.Errorf("GET request for %s failed: %s", listURL, http.StatusText(resp.StatusCode))
-	}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return false, newHTTPError(req, resp)
+		}
 
-	*logList = resp.Body
-	return nil
+		*logList = resp.Body
+		return false, nil
+	})
+	return err
 }
 
-func fetchSCxLogs(conn *http.Client, archive s.LogArchive, startDate time.Time, endDate time.Time, japan *time.Location, old bool) error {
+// parseLogListFile extracts the log type and date from a list.cgi file name,
+// which is either scbYYYYMMDD... for the current list or YYYY/scbYYYYMMDD...
+// for the old one.
+func parseLogListFile(file string, japan *time.Location) (string, time.Time, error) {
+	base := path.Base(file)
+	if len(base) < 11 {
+		return "", time.Time{}, fmt.Errorf("Invalid log file name %s", file)
+	}
+	date, err := time.ParseInLocation("20060102", base[3:11], japan)
+	return base[:3], date, err
+}
+
+func fetchSCxLogs(conn *http.Client, archive s.LogArchive, opts FetchOptions, startDate time.Time, endDate time.Time, japan *time.Location, old bool) error {
 	var logList io.ReadCloser
-	err := getLogList(conn, old, &logList)
+	err := getLogList(conn, opts, old, &logList)
 	if err != nil {
 		return err
 	}
@@ -164,19 +445,15 @@ func fetchSCxLogs(conn *http.Client, archive s.LogArchive, startDate time.Time,
 	if err != nil {
 		return err
 	}
+	pool := newWorkerPool(opts.Workers)
 	for parser.Scan() {
 		var scx string
 		var date time.Time
 
 		tok := parser.Token()
-		if old {
-			scx = tok.File[5:8]
-			date, err = time.ParseInLocation("20060102", tok.File[8:16], japan)
-		} else {
-			scx = tok.File[:3]
-			date, err = time.ParseInLocation("20060102", tok.File[3:11], japan)
-		}
+		scx, date, err = parseLogListFile(tok.File, japan)
 		if err != nil {
+			pool.Wait()
 			return err
 		}
 
@@ -187,26 +464,39 @@ func fetchSCxLogs(conn *http.Client, archive s.LogArchive, startDate time.Time,
 		logInfo := archive.AddSCxLogInfo(scx, date, path.Base(tok.File))
 
 		if exists, err := logInfo.Exists(); err != nil {
+			pool.Wait()
 			return err
 		} else if exists {
+			opts.Summary.record(tok.File, true, nil)
 			continue
 		}
 
-		logURL, _ := url.Parse(scrawBase)
-		logURL.Path = path.Join(logURL.Path, "dat", tok.File)
+		f := s.FailedFetch{Kind: s.FailedSCx, Item: tok.File}
+		if opts.knownFailure(f) {
+			continue
+		}
 
-		err = fetchArchivedLog(conn, &logInfo, logURL.String())
-		if err != nil {
-			return err
+		logURL := opts.Endpoints.scrawURL("dat", tok.File)
+
+		ok := pool.Submit(func() error {
+			skipped, err := fetchArchivedLogWithRetry(conn, opts, &logInfo, logURL.String())
+			opts.record(f, skipped, err)
+			return nil
+		})
+		if !ok {
+			break
 		}
 	}
+	if err = pool.Wait(); err != nil {
+		return err
+	}
 	if err = parser.Err(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func FetchSCx(conn *http.Client, archive s.LogArchive, startDate string, endDate string, errChan chan error, done chan int) {
+func FetchSCx(conn *http.Client, archive s.LogArchive, opts FetchOptions, startDate string, endDate string, errChan chan error, done chan int) {
 	defer func() { done <- 1 }()
 
 	japan, err := time.LoadLocation("Japan")
@@ -225,28 +515,134 @@ func FetchSCx(conn *http.Client, archive s.LogArchive, startDate string, endDate
 		return
 	}
 
-	// TODO: check what happens when the year rolls over
 	now := time.Now().In(japan)
 	now = time.Date(now.Year(), now.Month(), now.Day(), 00, 00, 00, 00, japan)
-	if start.Year() < now.Year() {
-		// TODO: need to unpack/fetch scraw files here
-		start = time.Date(now.Year(), 01, 01, 00, 00, 00, 00, japan)
+	if end.After(now) {
+		end = now
+	}
+	if start.After(end) {
+		errChan <- fmt.Errorf("Start date %s is after end date %s", start.Format("2006-01-02"), end.Format("2006-01-02"))
+		return
 	}
 
+	// Past years come from the yearly SCRAW zips. Last year's zip may not
+	// be published yet early in the year, in which case its days are
+	// looked for in the old list below.
+	for year := start.Year(); year < now.Year() && year <= end.Year(); year++ {
+		yStart, yEnd := clampYear(year, start, end, japan)
+		missing, err := archive.MissingSCxDays(yStart, yEnd)
+		if err != nil {
+			errChan <- err
+			return
+		} else if len(missing) == 0 {
+			continue
+		}
+
+		f := s.FailedFetch{Kind: s.FailedSCRAW, Item: fmt.Sprintf("scraw%d.zip", year)}
+		if opts.knownFailure(f) {
+			continue
+		}
+		skipped, err := fetchSCRAWYear(conn, archive, opts, year, yStart, yEnd)
+		if err != nil && year == now.Year()-1 {
+			continue
+		}
+		opts.record(f, skipped, err)
+	}
+
+	// Hourly logs older than the current list are aggregated first, so that
+	// the daily logs from the old list are not downloaded again
 	cutoff := now.AddDate(0, 0, -8)
 	if start.Before(cutoff) {
-		err = archive.AggregateLogs(japan, cutoff)
-		err = fetchSCxLogs(conn, archive, start, end, japan, true)
+		err = archive.AggregateLogs(japan, s.AggregateOptions{Cutoff: cutoff})
+		if err == nil {
+			err = fetchSCxLogs(conn, archive, opts, start, end, japan, true)
+		}
+	}
+	if err == nil && !end.Before(cutoff) {
+		err = fetchSCxLogs(conn, archive, opts, start, end, japan, false)
+	}
+	if err != nil {
+		errChan <- err
+		return
 	}
+
+	missing, err := archive.MissingSCxDays(start, end)
 	if err != nil {
 		errChan <- err
 		return
 	}
-	if end.After(cutoff) {
-		err = fetchSCxLogs(conn, archive, start, end, japan, false)
+	for _, day := range missing {
+		opts.Summary.record(day.Format("2006-01-02"), false, errDayNotFound)
 	}
+}
+
+// clampYear returns the part of the range between start and end that falls
+// into year.
+func clampYear(year int, start, end time.Time, japan *time.Location) (time.Time, time.Time) {
+	yStart := time.Date(year, 01, 01, 00, 00, 00, 00, japan)
+	yEnd := time.Date(year, 12, 31, 00, 00, 00, 00, japan)
+	if start.After(yStart) {
+		yStart = start
+	}
+	if end.Before(yEnd) {
+		yEnd = end
+	}
+	return yStart, yEnd
+}
+
+func retryFailed(conn *http.Client, archive s.LogArchive, opts FetchOptions, japan *time.Location, f s.FailedFetch) (bool, error) {
+	switch f.Kind {
+	case s.FailedUserLog:
+		return withRetry(opts.Retries, func() (bool, error) {
+			return fetchGameLog(conn, opts.Endpoints, archive, s.UserLogInfo{LogID: f.Item, User: f.User, Dir: f.Dir})
+		})
+	case s.FailedSCx:
+		scx, date, err := parseLogListFile(f.Item, japan)
+		if err != nil {
+			return false, err
+		}
+		logInfo := archive.AddSCxLogInfo(scx, date, path.Base(f.Item))
+		logURL := opts.Endpoints.scrawURL("dat", f.Item)
+		return fetchArchivedLogWithRetry(conn, opts, &logInfo, logURL.String())
+	case s.FailedSCRAW:
+		var year int
+		if _, err := fmt.Sscanf(f.Item, "scraw%d.zip", &year); err != nil {
+			return false, fmt.Errorf("Invalid SCRAW file name %s", f.Item)
+		}
+		return fetchSCRAWYear(conn, archive, opts, year, time.Time{}, time.Time{})
+	default:
+		return false, fmt.Errorf("Unknown failed download type %s", f.Kind)
+	}
+}
+
+// FetchFailed attempts every download recorded in the failure ledger again,
+// including those that failed permanently.
+func FetchFailed(conn *http.Client, archive s.LogArchive, opts FetchOptions, errChan chan error, done chan int) {
+	defer func() { done <- 1 }()
+
+	if opts.Ledger == nil {
+		errChan <- fmt.Errorf("No failure ledger to retry from")
+		return
+	}
+	japan, err := time.LoadLocation("Japan")
 	if err != nil {
 		errChan <- err
 		return
 	}
+
+	pool := newWorkerPool(opts.Workers)
+	for _, f := range opts.Ledger.Entries() {
+		f := f
+		ok := pool.Submit(func() error {
+			skipped, err := retryFailed(conn, archive, opts, japan, f)
+			opts.record(f, skipped, err)
+			return nil
+		})
+		if !ok {
+			break
+		}
+	}
+	if err := pool.Wait(); err != nil {
+		errChan <- err
+	}
 }